@@ -0,0 +1,29 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// adminToken guards the /api/admin/ endpoints. Admin endpoints are disabled
+// when it is empty.
+var adminToken string
+
+// requireAdmin checks the bearer token of an admin request, sending an error
+// response and returning false if the caller is not authorized
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if adminToken == "" {
+		sendErrorResponse(w, http.StatusForbidden, "Admin API disabled", "Set ADMIN_TOKEN to enable admin endpoints")
+		return false
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized", "A valid admin token is required")
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultStripParams are the tracking parameters removed unless
+// URL_STRIP_PARAMS says otherwise
+const defaultStripParams = "utm_*,fbclid,gclid,dclid,msclkid,mc_cid,mc_eid,igshid,_hsenc,_hsmi"
+
+// canonicalOptions controls the optional steps of URL canonicalization
+type canonicalOptions struct {
+	StripParams   []string // glob patterns of query parameter names to drop
+	SortQuery     bool
+	StripFragment bool
+}
+
+var canonical = canonicalOptions{StripParams: strings.Split(defaultStripParams, ",")}
+
+// loadCanonicalOptions reads URL_STRIP_PARAMS, URL_SORT_QUERY and
+// URL_STRIP_FRAGMENT from the environment. URL_STRIP_PARAMS=none keeps
+// every query parameter.
+func loadCanonicalOptions() (canonicalOptions, error) {
+	opts := canonicalOptions{
+		SortQuery:     os.Getenv("URL_SORT_QUERY") == "true",
+		StripFragment: os.Getenv("URL_STRIP_FRAGMENT") == "true",
+	}
+
+	params := os.Getenv("URL_STRIP_PARAMS")
+	if params == "" {
+		params = defaultStripParams
+	}
+	if params != "none" {
+		for _, pattern := range strings.Split(params, ",") {
+			pattern = strings.ToLower(strings.TrimSpace(pattern))
+			if pattern == "" {
+				continue
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return opts, fmt.Errorf("invalid URL_STRIP_PARAMS pattern %q", pattern)
+			}
+			opts.StripParams = append(opts.StripParams, pattern)
+		}
+	}
+
+	return opts, nil
+}
+
+// canonicalizeURL rewrites an HTTP(S) URL into a canonical form so that
+// equivalent URLs compare equal: lowercase scheme and host, IDN hosts in
+// punycode, no default port, dot segments resolved, consistent
+// percent-encoding, and tracking parameters removed.
+func canonicalizeURL(rawURL string, opts canonicalOptions) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+
+	host, err := canonicalHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	port := u.Port()
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+
+	var b strings.Builder
+	b.WriteString(scheme + "://")
+	if u.User != nil {
+		b.WriteString(u.User.String() + "@")
+	}
+	if strings.Contains(host, ":") {
+		b.WriteString("[" + host + "]")
+	} else {
+		b.WriteString(host)
+	}
+	if port != "" {
+		b.WriteString(":" + port)
+	}
+
+	escapedPath := removeDotSegments(normalizePercentEncoding(u.EscapedPath()))
+	if escapedPath == "" {
+		escapedPath = "/"
+	}
+	b.WriteString(escapedPath)
+
+	if query := canonicalQuery(u.RawQuery, opts); query != "" {
+		b.WriteString("?" + query)
+	}
+
+	if fragment := u.EscapedFragment(); fragment != "" && !opts.StripFragment {
+		b.WriteString("#" + normalizePercentEncoding(fragment))
+	}
+
+	return b.String(), nil
+}
+
+// canonicalHost lowercases a host name and converts internationalized
+// labels to their punycode form. IP literals are returned in standard form.
+func canonicalHost(host string) (string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+
+	host = strings.ToLower(host)
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		encoded, err := punycodeEncode(label)
+		if err != nil {
+			return "", fmt.Errorf("invalid internationalized host %q: %w", host, err)
+		}
+		labels[i] = "xn--" + encoded
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// hostOf returns the canonical host of a URL, or an empty string if it has
+// none
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	host, err := canonicalHost(strings.TrimSuffix(u.Hostname(), "."))
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// canonicalQuery drops tracking parameters and empty pairs from a raw query
+// string, optionally sorting the rest by name
+func canonicalQuery(rawQuery string, opts canonicalOptions) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	var pairs []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		pair = normalizePercentEncoding(pair)
+
+		name := strings.SplitN(pair, "=", 2)[0]
+		if decoded, err := url.QueryUnescape(name); err == nil {
+			name = decoded
+		}
+		if isStrippedParam(strings.ToLower(name), opts.StripParams) {
+			continue
+		}
+		pairs = append(pairs, pair)
+	}
+
+	if opts.SortQuery {
+		sort.SliceStable(pairs, func(i, j int) bool {
+			return strings.SplitN(pairs[i], "=", 2)[0] < strings.SplitN(pairs[j], "=", 2)[0]
+		})
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+func isStrippedParam(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizePercentEncoding decodes percent-encoded unreserved characters and
+// uppercases the hex digits of every other escape
+func normalizePercentEncoding(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHexDigit(s[i+1]) && isHexDigit(s[i+2]) {
+			value := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreservedChar(value) {
+				b.WriteByte(value)
+			} else {
+				b.WriteString("%" + strings.ToUpper(s[i+1:i+3]))
+			}
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// removeDotSegments resolves "." and ".." segments as described in
+// RFC 3986 section 5.2.4
+func removeDotSegments(p string) string {
+	if !strings.Contains(p, ".") {
+		return p
+	}
+
+	segments := strings.Split(p, "/")
+	var output []string
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				output = append(output, "")
+			}
+		case "..":
+			if len(output) > 1 {
+				output = output[:len(output)-1]
+			}
+			if last {
+				output = append(output, "")
+			}
+		default:
+			output = append(output, segment)
+		}
+	}
+
+	result := strings.Join(output, "/")
+	if strings.HasPrefix(p, "/") && !strings.HasPrefix(result, "/") {
+		result = "/" + result
+	}
+	return result
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+// Punycode parameters from RFC 3492 section 5
+const (
+	punycodeBase        = 36
+	punycodeTMin        = 1
+	punycodeTMax        = 26
+	punycodeSkew        = 38
+	punycodeDamp        = 700
+	punycodeInitialBias = 72
+	punycodeInitialN    = 128
+)
+
+// punycodeEncode encodes a Unicode label as described in RFC 3492, without
+// the "xn--" prefix
+func punycodeEncode(label string) (string, error) {
+	if !utf8.ValidString(label) {
+		return "", fmt.Errorf("label is not valid UTF-8")
+	}
+
+	runes := []rune(label)
+	var out []byte
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	handled := basic
+	if basic > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := rune(punycodeInitialN), 0, punycodeInitialBias
+	for handled < len(runes) {
+		// Find the smallest code point not yet handled
+		next := rune(0x7fffffff)
+		for _, r := range runes {
+			if r >= n && r < next {
+				next = r
+			}
+		}
+
+		if int(next-n) > (1<<31-1-delta)/(handled+1) {
+			return "", fmt.Errorf("label is too long")
+		}
+		delta += int(next-n) * (handled + 1)
+		n = next
+
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+
+			q := delta
+			for k := punycodeBase; ; k += punycodeBase {
+				t := k - bias
+				if t < punycodeTMin {
+					t = punycodeTMin
+				} else if t > punycodeTMax {
+					t = punycodeTMax
+				}
+				if q < t {
+					break
+				}
+				out = append(out, punycodeDigit(t+(q-t)%(punycodeBase-t)))
+				q = (q - t) / (punycodeBase - t)
+			}
+			out = append(out, punycodeDigit(q))
+
+			bias = punycodeAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+
+	return string(out), nil
+}
+
+// punycodeAdapt is the bias adaptation function of RFC 3492 section 6.1
+func punycodeAdapt(delta, numPoints int, firstTime bool) int {
+	if firstTime {
+		delta /= punycodeDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+
+	k := 0
+	for delta > ((punycodeBase-punycodeTMin)*punycodeTMax)/2 {
+		delta /= punycodeBase - punycodeTMin
+		k += punycodeBase
+	}
+	return k + (punycodeBase-punycodeTMin+1)*delta/(delta+punycodeSkew)
+}
+
+func punycodeDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+// punycodeDecode decodes a label encoded as described in RFC 3492, without
+// the "xn--" prefix
+func punycodeDecode(encoded string) (string, error) {
+	var output []rune
+	rest := encoded
+	if i := strings.LastIndexByte(encoded, '-'); i >= 0 {
+		for _, c := range encoded[:i] {
+			if c >= utf8.RuneSelf {
+				return "", fmt.Errorf("label is not valid punycode")
+			}
+			output = append(output, c)
+		}
+		rest = encoded[i+1:]
+	}
+
+	n, i, bias := rune(punycodeInitialN), 0, punycodeInitialBias
+	for pos := 0; pos < len(rest); {
+		oldI, w := i, 1
+		for k := punycodeBase; ; k += punycodeBase {
+			if pos >= len(rest) {
+				return "", fmt.Errorf("label is not valid punycode")
+			}
+			digit, ok := punycodeValue(rest[pos])
+			pos++
+			if !ok || digit > (1<<31-1-i)/w {
+				return "", fmt.Errorf("label is not valid punycode")
+			}
+			i += digit * w
+
+			t := k - bias
+			if t < punycodeTMin {
+				t = punycodeTMin
+			} else if t > punycodeTMax {
+				t = punycodeTMax
+			}
+			if digit < t {
+				break
+			}
+			w *= punycodeBase - t
+		}
+
+		bias = punycodeAdapt(i-oldI, len(output)+1, oldI == 0)
+		n += rune(i / (len(output) + 1))
+		i %= len(output) + 1
+		if n > utf8.MaxRune {
+			return "", fmt.Errorf("label is not valid punycode")
+		}
+
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = n
+		i++
+	}
+
+	return string(output), nil
+}
+
+func punycodeValue(c byte) (int, bool) {
+	switch {
+	case c >= 'a' && c <= 'z':
+		return int(c - 'a'), true
+	case c >= 'A' && c <= 'Z':
+		return int(c - 'A'), true
+	case c >= '0' && c <= '9':
+		return int(c-'0') + 26, true
+	}
+	return 0, false
+}
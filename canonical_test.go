@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCanonicalizeURL(t *testing.T) {
+	defaults := canonicalOptions{StripParams: strings.Split(defaultStripParams, ",")}
+	sorted := canonicalOptions{StripParams: defaults.StripParams, SortQuery: true}
+	noFragment := canonicalOptions{StripParams: defaults.StripParams, StripFragment: true}
+
+	tests := []struct {
+		name  string
+		input string
+		opts  canonicalOptions
+		want  string
+	}{
+		{"lowercase scheme and host", "HTTP://Example.COM/", defaults, "http://example.com/"},
+		{"empty path", "http://example.com", defaults, "http://example.com/"},
+		{"default http port", "http://example.com:80/a", defaults, "http://example.com/a"},
+		{"default https port", "https://example.com:443/a", defaults, "https://example.com/a"},
+		{"other port kept", "https://example.com:8443/a", defaults, "https://example.com:8443/a"},
+		{"http port on https kept", "https://example.com:80/a", defaults, "https://example.com:80/a"},
+		{"parent segment", "http://example.com/a/../b", defaults, "http://example.com/b"},
+		{"current segments", "http://example.com/a/./b/.", defaults, "http://example.com/a/b/"},
+		{"parent above root", "http://example.com/../../a", defaults, "http://example.com/a"},
+		{"unreserved decoded", "http://example.com/%7Euser/%41", defaults, "http://example.com/~user/A"},
+		{"reserved kept encoded", "http://example.com/a%2fb", defaults, "http://example.com/a%2Fb"},
+		{"idn host", "https://bücher.de/", defaults, "https://xn--bcher-kva.de/"},
+		{"idn subdomain", "https://mañana.example.com/", defaults, "https://xn--maana-pta.example.com/"},
+		{"ipv6 literal", "http://[2001:DB8:0::1]:80/", defaults, "http://[2001:db8::1]/"},
+		{"utm params", "http://example.com/b?utm_source=x&utm_medium=y", defaults, "http://example.com/b"},
+		{"click ids", "http://example.com/b?id=1&fbclid=abc&gclid=def", defaults, "http://example.com/b?id=1"},
+		{"empty param", "http://example.com/b?a=1&", defaults, "http://example.com/b?a=1"},
+		{"query order kept", "http://example.com/?b=2&a=1", defaults, "http://example.com/?b=2&a=1"},
+		{"query sorted", "http://example.com/?b=2&a=1&a=0", sorted, "http://example.com/?a=1&a=0&b=2"},
+		{"fragment kept", "http://example.com/b#section-2", defaults, "http://example.com/b#section-2"},
+		{"fragment stripped", "http://example.com/b#section-2", noFragment, "http://example.com/b"},
+		{"everything", "http://Example.com:80/a/../b?utm_source=x#frag", noFragment, "http://example.com/b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := canonicalizeURL(tt.input, tt.opts)
+			if err != nil {
+				t.Fatalf("canonicalizeURL(%q) returned error: %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("canonicalizeURL(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPunycode(t *testing.T) {
+	// Examples from RFC 3492 section 7.1 and common IDN labels
+	tests := []struct {
+		decoded string
+		encoded string
+	}{
+		{"bücher", "bcher-kva"},
+		{"mañana", "maana-pta"},
+		{"münchen", "mnchen-3ya"},
+		{"пример", "e1afmkfd"},
+		{"例え", "r8jz45g"},
+		{"他们为什么不说中文", "ihqwcrb4cv8a8dqg056pqjye"},
+		{"3年B組金八先生", "3B-ww4c5e180e575a65lsy2b"},
+		{"ليهمابتكلموشعربي؟", "egbpdaj6bu4bxfgehfvwxn"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.encoded, func(t *testing.T) {
+			encoded, err := punycodeEncode(tt.decoded)
+			if err != nil {
+				t.Fatalf("punycodeEncode(%q) returned error: %v", tt.decoded, err)
+			}
+			if encoded != tt.encoded {
+				t.Errorf("punycodeEncode(%q) = %q, want %q", tt.decoded, encoded, tt.encoded)
+			}
+
+			decoded, err := punycodeDecode(tt.encoded)
+			if err != nil {
+				t.Fatalf("punycodeDecode(%q) returned error: %v", tt.encoded, err)
+			}
+			if decoded != tt.decoded {
+				t.Errorf("punycodeDecode(%q) = %q, want %q", tt.encoded, decoded, tt.decoded)
+			}
+		})
+	}
+}
+
+func TestPunycodeDecodeInvalid(t *testing.T) {
+	for _, input := range []string{"a-9999999999", "abc-!"} {
+		if decoded, err := punycodeDecode(input); err == nil {
+			t.Errorf("punycodeDecode(%q) = %q, want an error", input, decoded)
+		}
+	}
+}
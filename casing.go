@@ -0,0 +1,64 @@
+package main
+
+import "strings"
+
+// caseInsensitiveCodes stores and looks up codes in lowercase so that
+// "Abc123" and "abc123" reach the same link. Links live only in memory,
+// so the mode always starts from a fresh store and existing codes never
+// need migrating.
+var caseInsensitiveCodes bool
+
+// canonicalCode returns the form a code is stored under
+func canonicalCode(code string) string {
+	if caseInsensitiveCodes {
+		return strings.ToLower(code)
+	}
+	return code
+}
+
+// lookupCode finds the stored key and destination for a requested code.
+// An exact match wins, then the canonical form is tried, and for crockford
+// codes the form with misread characters corrected.
+func lookupCode(code string) (string, string, bool) {
+	candidates := []string{code, canonicalCode(code)}
+	if codes.crockford {
+		candidates = append(candidates, codes.normalizeCrockford(code))
+	}
+
+	// Most unknown codes are ruled out without taking the store lock
+	possible := false
+	for _, candidate := range candidates {
+		if codeFilter.mightContain(candidate) {
+			possible = true
+			break
+		}
+	}
+	if !possible {
+		return "", "", false
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	for _, candidate := range candidates {
+		if originalURL, exists := store.urls[candidate]; exists {
+			return candidate, originalURL, true
+		}
+	}
+
+	return "", "", false
+}
+
+// foldAlphabetCase lowercases an alphabet and drops the duplicates this
+// creates, so generated codes are already canonical
+func foldAlphabetCase(alphabet string) string {
+	var b strings.Builder
+	seen := make(map[rune]bool)
+	for _, char := range strings.ToLower(alphabet) {
+		if !seen[char] {
+			seen[char] = true
+			b.WriteRune(char)
+		}
+	}
+	return b.String()
+}
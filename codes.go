@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// codeAlphabets holds the named alphabets accepted by CODE_ALPHABET
+var codeAlphabets = map[string]string{
+	"base62": "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789",
+	// Crockford base32 leaves out I, L, O and U to avoid misreading
+	"crockford": "0123456789ABCDEFGHJKMNPQRSTVWXYZ",
+	// Lowercase letters and digits for case-insensitive systems
+	"lowercase": "abcdefghijklmnopqrstuvwxyz0123456789",
+}
+
+const (
+	defaultCodeLength = 6
+	minCodeLength     = 4
+	maxCodeLength     = 32
+)
+
+// codeConfig describes the shape of generated short codes
+type codeConfig struct {
+	Length   int
+	Alphabet string
+	allowed  [128]bool
+	// crockford is set for the crockford alphabet, whose codes are also
+	// found when read back with O for 0 or I and L for 1
+	crockford bool
+}
+
+var codes = mustCodeConfig(defaultCodeLength, codeAlphabets["base62"])
+
+// newCodeConfig validates a code length and alphabet
+func newCodeConfig(length int, alphabet string) (*codeConfig, error) {
+	if length < minCodeLength || length > maxCodeLength {
+		return nil, fmt.Errorf("code length must be between %d and %d", minCodeLength, maxCodeLength)
+	}
+
+	cfg := &codeConfig{Length: length}
+	for i := 0; i < len(alphabet); i++ {
+		char := alphabet[i]
+		// Codes appear in URL paths, so only unreserved characters are allowed
+		if !isUnreservedChar(char) {
+			return nil, fmt.Errorf("alphabet character %q is not allowed in a URL path", char)
+		}
+		if cfg.allowed[char] {
+			return nil, fmt.Errorf("alphabet character %q is repeated", char)
+		}
+		cfg.allowed[char] = true
+	}
+	if len(alphabet) < 2 {
+		return nil, fmt.Errorf("alphabet must contain at least 2 characters")
+	}
+	cfg.Alphabet = alphabet
+
+	return cfg, nil
+}
+
+func mustCodeConfig(length int, alphabet string) *codeConfig {
+	cfg, err := newCodeConfig(length, alphabet)
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+// loadCodeConfig reads CODE_LENGTH and CODE_ALPHABET from the environment.
+// CODE_ALPHABET is either a name from codeAlphabets or the literal characters.
+func loadCodeConfig() (*codeConfig, error) {
+	length := defaultCodeLength
+	if value := os.Getenv("CODE_LENGTH"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CODE_LENGTH %q", value)
+		}
+		length = parsed
+	}
+
+	alphabet := codeAlphabets["base62"]
+	crockford := false
+	if value := os.Getenv("CODE_ALPHABET"); value != "" {
+		if named, ok := codeAlphabets[strings.ToLower(value)]; ok {
+			alphabet = named
+			crockford = strings.EqualFold(value, "crockford")
+		} else {
+			alphabet = value
+		}
+	}
+	if caseInsensitiveCodes {
+		alphabet = foldAlphabetCase(alphabet)
+	}
+
+	cfg, err := newCodeConfig(length, alphabet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid code configuration: %w", err)
+	}
+	cfg.crockford = crockford
+	return cfg, nil
+}
+
+// normalizeCrockford maps a code as a person may have retyped it onto the
+// crockford alphabet: case is folded to match the alphabet, O becomes 0,
+// I and L become 1, and hyphens are dropped
+func (c *codeConfig) normalizeCrockford(code string) string {
+	var b strings.Builder
+	for _, char := range strings.ToUpper(code) {
+		switch char {
+		case 'O':
+			char = '0'
+		case 'I', 'L':
+			char = '1'
+		case '-':
+			continue
+		}
+		b.WriteRune(char)
+	}
+	if caseInsensitiveCodes {
+		return strings.ToLower(b.String())
+	}
+	return b.String()
+}
+
+// maxLength is the longest code accepted on lookup
+func (c *codeConfig) maxLength() int {
+	if c.Length > 20 {
+		return c.Length
+	}
+	return 20
+}
+
+// isCodeChar reports whether char may appear in a short code, either from
+// the generator alphabet or the custom code character set
+func (c *codeConfig) isCodeChar(char rune) bool {
+	if isCustomCodeChar(char) {
+		return true
+	}
+	return char < 128 && c.allowed[char]
+}
+
+// isCustomCodeChar reports whether char may appear in a custom code
+func isCustomCodeChar(char rune) bool {
+	return (char >= 'a' && char <= 'z') ||
+		(char >= 'A' && char <= 'Z') ||
+		(char >= '0' && char <= '9') ||
+		char == '-'
+}
+
+// isUnreservedChar reports whether char is an RFC 3986 unreserved character
+func isUnreservedChar(char byte) bool {
+	return (char >= 'a' && char <= 'z') ||
+		(char >= 'A' && char <= 'Z') ||
+		(char >= '0' && char <= '9') ||
+		char == '-' || char == '.' || char == '_' || char == '~'
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Domain policy modes
+const (
+	domainBlocklist = "blocklist" // everything except blocked domains
+	domainAllowlist = "allowlist" // only allowed domains, minus blocked ones
+)
+
+// domainRules is a parsed rule file. Each line is an exact domain
+// ("example.com"), a wildcard matching every subdomain ("*.example.com",
+// which does not match the domain itself), or a CIDR range matching IP
+// literals ("10.0.0.0/8").
+type domainRules struct {
+	exact    map[string]bool
+	suffixes []string // ".example.com" for "*.example.com"
+	networks []*net.IPNet
+}
+
+// domainPolicy decides which destination hosts may be shortened and
+// redirected to
+type domainPolicy struct {
+	mode      string
+	blockPath string
+	allowPath string
+	block     *domainRules
+	allow     *domainRules
+	mu        sync.RWMutex
+}
+
+var destinations = &domainPolicy{mode: domainBlocklist}
+
+// loadDomainPolicy reads DOMAIN_POLICY_MODE, DOMAIN_BLOCKLIST_FILE and
+// DOMAIN_ALLOWLIST_FILE from the environment and loads the rule files
+func loadDomainPolicy() error {
+	mode := os.Getenv("DOMAIN_POLICY_MODE")
+	if mode == "" {
+		mode = domainBlocklist
+	}
+	if mode != domainBlocklist && mode != domainAllowlist {
+		return fmt.Errorf("invalid DOMAIN_POLICY_MODE %q: must be %q or %q", mode, domainBlocklist, domainAllowlist)
+	}
+
+	allowPath := os.Getenv("DOMAIN_ALLOWLIST_FILE")
+	if mode == domainAllowlist && allowPath == "" {
+		return fmt.Errorf("DOMAIN_POLICY_MODE=allowlist requires DOMAIN_ALLOWLIST_FILE")
+	}
+
+	destinations.mu.Lock()
+	destinations.mode = mode
+	destinations.blockPath = os.Getenv("DOMAIN_BLOCKLIST_FILE")
+	destinations.allowPath = allowPath
+	destinations.mu.Unlock()
+
+	return destinations.reload()
+}
+
+// reload re-reads the rule files. Either both load or neither is replaced.
+func (p *domainPolicy) reload() error {
+	p.mu.RLock()
+	blockPath, allowPath := p.blockPath, p.allowPath
+	p.mu.RUnlock()
+
+	var block, allow *domainRules
+	var err error
+	if blockPath != "" {
+		if block, err = readDomainRules(blockPath); err != nil {
+			return err
+		}
+		log.Printf("Loaded %d blocked destination rules from %s", block.size(), blockPath)
+	}
+	if allowPath != "" {
+		if allow, err = readDomainRules(allowPath); err != nil {
+			return err
+		}
+		log.Printf("Loaded %d allowed destination rules from %s", allow.size(), allowPath)
+	}
+
+	p.mu.Lock()
+	p.block, p.allow = block, allow
+	p.mu.Unlock()
+	return nil
+}
+
+// readDomainRules parses a rule file in the format of readPatternFile
+func readDomainRules(filename string) (*domainRules, error) {
+	lines, err := readPatternFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := &domainRules{exact: make(map[string]bool)}
+	for _, line := range lines {
+		if strings.Contains(line, "/") {
+			_, network, err := net.ParseCIDR(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid CIDR range %q", filename, line)
+			}
+			rules.networks = append(rules.networks, network)
+			continue
+		}
+
+		wildcard := strings.HasPrefix(line, "*.")
+		host, err := canonicalHost(strings.TrimSuffix(strings.TrimPrefix(line, "*."), "."))
+		if err != nil || host == "" || strings.ContainsAny(host, "*?[") {
+			return nil, fmt.Errorf("%s: invalid domain %q", filename, line)
+		}
+		if wildcard {
+			rules.suffixes = append(rules.suffixes, "."+host)
+		} else {
+			rules.exact[host] = true
+		}
+	}
+	return rules, nil
+}
+
+func (r *domainRules) size() int {
+	return len(r.exact) + len(r.suffixes) + len(r.networks)
+}
+
+// matches reports whether a canonical host is covered by the rules
+func (r *domainRules) matches(host string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		for _, network := range r.networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return r.exact[ip.String()]
+	}
+
+	if r.exact[host] {
+		return true
+	}
+	for _, suffix := range r.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns the reason a destination is not allowed by the policy, or
+// an empty string if it is
+func (p *domainPolicy) check(rawURL string) string {
+	host := hostOf(rawURL)
+	if host == "" {
+		return "URL must be a valid HTTP or HTTPS URL"
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.block != nil && p.block.matches(host) {
+		return fmt.Sprintf("Destination %s is blocked", host)
+	}
+	if p.mode == domainAllowlist && (p.allow == nil || !p.allow.matches(host)) {
+		return fmt.Sprintf("Destination %s is not on the allowlist", host)
+	}
+	return ""
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultEnumerationThreshold = 30
+	defaultEnumerationBlock     = 10 * time.Minute
+	enumerationWindow           = time.Minute
+
+	// Past half the threshold every miss waits a little longer, up to
+	// maxEnumerationDelay
+	enumerationDelayStep = 100 * time.Millisecond
+	maxEnumerationDelay  = 2 * time.Second
+
+	// maxTrackedClients bounds the tracker's memory; stale entries are
+	// swept when it is reached
+	maxTrackedClients = 100000
+
+	initialFilterCapacity = 100000
+	filterFalsePositives  = 0.01
+)
+
+// clientMisses counts a client's 404s in the current window
+type clientMisses struct {
+	windowStart  time.Time
+	misses       int
+	blockedUntil time.Time
+}
+
+// scanDetector slows down and then blocks clients that request many codes
+// that do not exist
+type scanDetector struct {
+	threshold int // 404s per window before blocking; 0 disables
+	block     time.Duration
+	clients   map[string]*clientMisses
+	mu        sync.Mutex
+}
+
+var scanners = &scanDetector{
+	threshold: defaultEnumerationThreshold,
+	block:     defaultEnumerationBlock,
+	clients:   make(map[string]*clientMisses),
+}
+
+// loadScanDetector reads ENUMERATION_THRESHOLD and ENUMERATION_BLOCK from
+// the environment
+func loadScanDetector() error {
+	if value := os.Getenv("ENUMERATION_THRESHOLD"); value != "" {
+		threshold, err := strconv.Atoi(value)
+		if err != nil || threshold < 0 {
+			return fmt.Errorf("invalid ENUMERATION_THRESHOLD %q: must be a number of 404s per minute, 0 to disable", value)
+		}
+		scanners.threshold = threshold
+	}
+
+	if value := os.Getenv("ENUMERATION_BLOCK"); value != "" {
+		block, err := time.ParseDuration(value)
+		if err != nil || block <= 0 {
+			return fmt.Errorf("invalid ENUMERATION_BLOCK %q: must be a positive duration", value)
+		}
+		scanners.block = block
+	}
+	return nil
+}
+
+// blockedFor returns how long a client remains blocked, or 0
+func (d *scanDetector) blockedFor(client string) time.Duration {
+	if d.threshold == 0 {
+		return 0
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if entry, exists := d.clients[client]; exists {
+		return time.Until(entry.blockedUntil)
+	}
+	return 0
+}
+
+// miss records a 404 for a client and returns how long to delay the
+// response
+func (d *scanDetector) miss(client string) time.Duration {
+	if d.threshold == 0 {
+		return 0
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	entry, exists := d.clients[client]
+	if !exists {
+		if len(d.clients) >= maxTrackedClients {
+			d.sweep(now)
+		}
+		entry = &clientMisses{windowStart: now}
+		d.clients[client] = entry
+	}
+	if now.Sub(entry.windowStart) > enumerationWindow {
+		entry.windowStart = now
+		entry.misses = 0
+	}
+	entry.misses++
+
+	if entry.misses > d.threshold {
+		entry.blockedUntil = now.Add(d.block)
+		entry.misses = 0
+		log.Printf("Blocked %s for %s after too many unknown codes", client, d.block)
+		return 0
+	}
+
+	over := entry.misses - d.threshold/2
+	if over <= 0 {
+		return 0
+	}
+	delay := time.Duration(over) * enumerationDelayStep
+	if delay > maxEnumerationDelay {
+		delay = maxEnumerationDelay
+	}
+	return delay
+}
+
+// sweep drops clients with no recent misses and no active block. The
+// caller holds d.mu.
+func (d *scanDetector) sweep(now time.Time) {
+	for client, entry := range d.clients {
+		if now.Sub(entry.windowStart) > enumerationWindow && now.After(entry.blockedUntil) {
+			delete(d.clients, client)
+		}
+	}
+}
+
+// rejectBlockedClient answers 429 if the client is blocked, reporting
+// whether it did
+func rejectBlockedClient(w http.ResponseWriter, r *http.Request) bool {
+	wait := scanners.blockedFor(clientIP(r))
+	if wait <= 0 {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	http.Error(w, "Too many requests for unknown links", http.StatusTooManyRequests)
+	return true
+}
+
+// sendNotFound answers 404 for a code that does not exist, counting it
+// against the client and slowing down clients that miss often
+func sendNotFound(w http.ResponseWriter, r *http.Request) {
+	if recordMiss(r) {
+		http.NotFound(w, r)
+	}
+}
+
+// recordMiss counts a request for an unknown code against the client and
+// waits out any delay, reporting false if the client gave up meanwhile
+func recordMiss(r *http.Request) bool {
+	if delay := scanners.miss(clientIP(r)); delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return false
+		}
+	}
+	return true
+}
+
+// bloomFilter answers "definitely not stored" for most unknown codes
+// without touching the store. It doubles in size when it fills up.
+type bloomFilter struct {
+	bits     []uint64
+	hashes   int
+	capacity int
+	count    int
+	mu       sync.RWMutex
+}
+
+var codeFilter = newBloomFilter(initialFilterCapacity)
+
+func newBloomFilter(capacity int) *bloomFilter {
+	f := &bloomFilter{}
+	f.reset(capacity)
+	return f
+}
+
+// reset sizes the filter for capacity items at filterFalsePositives and
+// empties it. The caller holds f.mu or owns f.
+func (f *bloomFilter) reset(capacity int) {
+	bits := int(math.Ceil(-float64(capacity) * math.Log(filterFalsePositives) / (math.Ln2 * math.Ln2)))
+	f.bits = make([]uint64, (bits+63)/64)
+	f.hashes = int(math.Round(float64(len(f.bits)*64) / float64(capacity) * math.Ln2))
+	f.capacity = capacity
+	f.count = 0
+}
+
+// positions returns the bit positions for item using double hashing
+func (f *bloomFilter) positions(item string) (uint64, uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(item))
+	sum := h.Sum64()
+	return sum & 0xffffffff, sum>>32 | 1, uint64(len(f.bits) * 64)
+}
+
+// add inserts item, reporting whether the filter is now over capacity
+func (f *bloomFilter) add(item string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.insert(item)
+	return f.count > f.capacity
+}
+
+func (f *bloomFilter) insert(item string) {
+	h1, h2, size := f.positions(item)
+	for i := uint64(0); i < uint64(f.hashes); i++ {
+		bit := (h1 + i*h2) % size
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.count++
+}
+
+// mightContain reports whether item may have been added
+func (f *bloomFilter) mightContain(item string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	h1, h2, size := f.positions(item)
+	for i := uint64(0); i < uint64(f.hashes); i++ {
+		bit := (h1 + i*h2) % size
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// grow doubles the capacity and re-adds every code. The caller holds
+// store.mu.
+func (f *bloomFilter) grow(codes map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.reset(f.capacity * 2)
+	for code := range codes {
+		f.insert(code)
+	}
+	log.Printf("Code filter grown to %d codes", f.capacity)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// defaultProtectedBrands is used when PROTECTED_BRANDS is not set
+const defaultProtectedBrands = "amazon,apple,facebook,github,google,instagram,microsoft,netflix,paypal"
+
+// Homograph actions: what to do with a suspicious destination
+const (
+	homographReject       = "reject"
+	homographInterstitial = "interstitial"
+)
+
+// confusables maps characters that render like a Latin letter or digit to
+// that letter, in the spirit of the Unicode confusables data (UTS #39).
+// Only the lookalikes seen in practice are listed.
+var confusables = map[rune]string{
+	// Cyrillic
+	'а': "a", 'в': "b", 'с': "c", 'ԁ': "d", 'е': "e", 'ё': "e", 'һ': "h",
+	'і': "i", 'ї': "i", 'ј': "j", 'к': "k", 'ӏ': "l", 'м': "m", 'н': "h",
+	'о': "o", 'р': "p", 'ԛ': "q", 'г': "r", 'ѕ': "s", 'т': "t", 'ц': "u",
+	'ѵ': "v", 'ԝ': "w", 'х': "x", 'у': "y", 'з': "3", 'ь': "b",
+	// Greek
+	'α': "a", 'β': "b", 'ε': "e", 'η': "n", 'ι': "i", 'κ': "k", 'ν': "v",
+	'ο': "o", 'ρ': "p", 'τ': "t", 'υ': "u", 'χ': "x", 'γ': "y", 'ω': "w",
+	// Armenian
+	'օ': "o", 'ս': "u", 'հ': "h", 'ո': "n", 'ց': "g", 'ք': "p",
+	// Latin lookalikes outside ASCII
+	'ı': "i", 'ɡ': "g", 'ɑ': "a", 'ʟ': "l", 'ℓ': "l", 'ß': "ss",
+}
+
+// asciiConfusables folds ASCII characters and sequences that are easily
+// mistaken for one another; applied after confusables
+var asciiConfusables = strings.NewReplacer(
+	"rn", "m", "vv", "w", "cl", "d",
+	"0", "o", "1", "l", "i", "l", "5", "s",
+)
+
+// scripts are the writing systems told apart by mixed-script detection
+var scripts = map[string]*unicode.RangeTable{
+	"Arabic": unicode.Arabic, "Armenian": unicode.Armenian, "Bopomofo": unicode.Bopomofo,
+	"Cherokee": unicode.Cherokee, "Cyrillic": unicode.Cyrillic, "Devanagari": unicode.Devanagari,
+	"Georgian": unicode.Georgian, "Greek": unicode.Greek, "Han": unicode.Han,
+	"Hangul": unicode.Hangul, "Hebrew": unicode.Hebrew, "Hiragana": unicode.Hiragana,
+	"Katakana": unicode.Katakana, "Latin": unicode.Latin, "Thai": unicode.Thai,
+}
+
+// scriptCombinations are the mixes that occur in ordinary writing, per the
+// "highly restrictive" profile of UTS #39
+var scriptCombinations = [][]string{
+	{"Latin", "Han", "Hiragana", "Katakana"},
+	{"Latin", "Han", "Bopomofo"},
+	{"Latin", "Han", "Hangul"},
+}
+
+// homographConfig holds the protected brands and what to do with lookalikes
+type homographConfig struct {
+	Brands map[string]string // skeleton -> brand
+	Action string
+}
+
+var homographs = newHomographConfig(strings.Split(defaultProtectedBrands, ","), homographReject)
+
+func newHomographConfig(brands []string, action string) homographConfig {
+	cfg := homographConfig{Brands: make(map[string]string), Action: action}
+	for _, brand := range brands {
+		brand = strings.ToLower(strings.TrimSpace(brand))
+		if brand != "" {
+			cfg.Brands[skeleton(brand)] = brand
+		}
+	}
+	return cfg
+}
+
+// loadHomographConfig reads PROTECTED_BRANDS and HOMOGRAPH_ACTION from the
+// environment
+func loadHomographConfig() (homographConfig, error) {
+	brands := os.Getenv("PROTECTED_BRANDS")
+	if brands == "" {
+		brands = defaultProtectedBrands
+	}
+
+	action := os.Getenv("HOMOGRAPH_ACTION")
+	if action == "" {
+		action = homographReject
+	}
+	if action != homographReject && action != homographInterstitial {
+		return homographConfig{}, fmt.Errorf("invalid HOMOGRAPH_ACTION %q: must be %q or %q", action, homographReject, homographInterstitial)
+	}
+
+	return newHomographConfig(strings.Split(brands, ","), action), nil
+}
+
+// check returns why a canonical (punycode) host looks like a spoof, or an
+// empty string if it does not
+func (c homographConfig) check(host string) string {
+	for _, label := range strings.Split(host, ".") {
+		if strings.HasPrefix(label, "xn--") {
+			decoded, err := punycodeDecode(label[4:])
+			if err != nil {
+				return fmt.Sprintf("Host label %q is not valid punycode", label)
+			}
+			label = decoded
+		}
+
+		if mixed := labelScripts(label); mixed != nil {
+			return fmt.Sprintf("Host label %q mixes %s characters", label, strings.Join(mixed, " and "))
+		}
+
+		// A brand name spelled with lookalikes, either as the whole label or
+		// as one of its hyphenated parts
+		for _, part := range append([]string{label}, strings.Split(label, "-")...) {
+			if brand, found := c.Brands[skeleton(part)]; found && part != brand {
+				return fmt.Sprintf("Host label %q imitates %q", label, brand)
+			}
+		}
+	}
+	return ""
+}
+
+// labelScripts returns the scripts used in a label if they are not a
+// combination found in ordinary writing, or nil
+func labelScripts(label string) []string {
+	seen := make(map[string]bool)
+	var used []string
+	for _, r := range label {
+		for name, table := range scripts {
+			if !seen[name] && unicode.Is(table, r) {
+				seen[name] = true
+				used = append(used, name)
+			}
+		}
+	}
+	if len(used) <= 1 {
+		return nil
+	}
+	sort.Strings(used)
+
+	for _, combination := range scriptCombinations {
+		allowed := true
+		for _, name := range used {
+			if !containsString(combination, name) {
+				allowed = false
+				break
+			}
+		}
+		if allowed {
+			return nil
+		}
+	}
+	return used
+}
+
+// skeleton maps a label to a form in which confusable spellings compare
+// equal, e.g. "pаypa1" (Cyrillic а) and "paypal"
+func skeleton(label string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(label) {
+		if replacement, found := confusables[r]; found {
+			b.WriteString(replacement)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return asciiConfusables.Replace(b.String())
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// continueTokenTTL is how long the continue link of an interstitial works
+const continueTokenTTL = 10 * time.Minute
+
+// interstitialCountdown is how many seconds the interstitial waits before
+// continuing on its own; 0 waits for the user. Links flagged as suspicious
+// never continue on their own.
+var interstitialCountdown int
+
+// loadInterstitialCountdown reads INTERSTITIAL_COUNTDOWN from the environment
+func loadInterstitialCountdown() (int, error) {
+	value := os.Getenv("INTERSTITIAL_COUNTDOWN")
+	if value == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 || seconds > 60 {
+		return 0, fmt.Errorf("invalid INTERSTITIAL_COUNTDOWN %q: must be between 0 and 60 seconds", value)
+	}
+	return seconds, nil
+}
+
+// needsInterstitial reports whether a link is shown behind the warning page
+func needsInterstitial(info linkInfo) bool {
+	return info.Warning != "" || info.Interstitial
+}
+
+// continueToken returns the value of the continue parameter that lets a
+// visitor past the interstitial of code until expires. It is signed so the
+// creator of a flagged link cannot hand out a URL that skips the warning.
+func continueToken(code string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	mac := hmac.New(sha256.New, accessCookieSecret)
+	mac.Write([]byte("continue\x00" + code + "\x00" + exp))
+	return exp + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// hasContinueToken reports whether the request carries a valid, unexpired
+// continue token for code
+func hasContinueToken(r *http.Request, code string) bool {
+	token := r.URL.Query().Get("continue")
+	exp, _, found := strings.Cut(token, ".")
+	if !found {
+		return false
+	}
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(continueToken(code, time.Unix(unix, 0))))
+}
+
+// getInterstitialPage returns the page shown before redirecting to a
+// flagged link or one created with the interstitial option. params are
+// carried over to the continue link, e.g. the signature of a signed link.
+func getInterstitialPage(code, destination string, info linkInfo, params url.Values, nonce string) string {
+	params.Set("continue", continueToken(code, time.Now().Add(continueTokenTTL)))
+	continueURL := "/" + url.PathEscape(code) + "?" + params.Encode()
+
+	title := "You are leaving QuickLink"
+	notice := "This short link points to the address below. Check that it is where you expect to go."
+	countdown := interstitialCountdown
+	if info.Warning != "" {
+		title = "This link may be unsafe"
+		notice = "The destination looks like it may be imitating another site: " + html.EscapeString(info.Warning) + "."
+		countdown = 0
+	}
+
+	refresh, countdownText := "", ""
+	if countdown > 0 {
+		refresh = fmt.Sprintf(`<meta http-equiv="refresh" content="%d;url=%s">`, countdown, html.EscapeString(continueURL))
+		countdownText = fmt.Sprintf(`<p class="countdown">Continuing automatically in <span id="seconds">%d</span> seconds.</p>`, countdown)
+	}
+
+	warningClass := ""
+	if info.Warning != "" {
+		warningClass = " warning"
+	}
+
+	return cardPage(nonce, title, refresh, `
+        .countdown {
+            font-size: 0.9rem;
+            color: #777;
+        }
+`, `    <div class="container`+warningClass+`">
+        <h1>`+title+`</h1>
+        <p>`+notice+`</p>
+        <div class="destination">`+html.EscapeString(destination)+`</div>
+        `+countdownText+`
+        <div class="actions">
+            <a class="btn btn-primary" href="`+html.EscapeString(continueURL)+`" rel="noreferrer">Continue to site</a>
+            <a class="btn btn-secondary" href="/">Go back</a>
+        </div>
+    </div>
+    <script nonce="`+nonce+`">
+        var seconds = document.getElementById('seconds');
+        if (seconds) {
+            setInterval(function() {
+                var left = parseInt(seconds.textContent, 10) - 1;
+                if (left >= 0) {
+                    seconds.textContent = left;
+                }
+            }, 1000);
+        }
+    </script>`)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestInterstitialContinue(t *testing.T) {
+	accessCookieSecret = []byte("interstitial-test-secret")
+	saveLink("warn1", "https://example.com/flagged", &linkInfo{Interstitial: true})
+	saveLink("warn2", "https://example.com/other", &linkInfo{Interstitial: true})
+
+	expired := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name       string
+		continueTo string
+		wantStatus int
+	}{
+		{"no token", "", http.StatusOK},
+		{"bare flag", "1", http.StatusOK},
+		{"forged token", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10) + ".AAAA", http.StatusOK},
+		{"token for another code", continueToken("warn2", time.Now().Add(continueTokenTTL)), http.StatusOK},
+		{"expired token", continueToken("warn1", expired), http.StatusOK},
+		{"valid token", continueToken("warn1", time.Now().Add(continueTokenTTL)), http.StatusFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := "/warn1"
+			if tt.continueTo != "" {
+				target += "?continue=" + url.QueryEscape(tt.continueTo)
+			}
+			rec := httptest.NewRecorder()
+			handleRedirect(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("GET %s = %d, want %d", target, rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusFound && rec.Header().Get("Location") != "https://example.com/flagged" {
+				t.Errorf("GET %s redirected to %q", target, rec.Header().Get("Location"))
+			}
+		})
+	}
+}
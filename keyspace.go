@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const (
+	defaultCollisionThreshold = 0.1
+	collisionWindow           = 100
+	maxAttemptsPerLength      = 10
+)
+
+// keyspaceMonitor tracks how full the random code space is and grows the
+// generated code length before collisions make generation fail
+type keyspaceMonitor struct {
+	length     int         // length currently used for generated codes
+	threshold  float64     // collision rate or occupancy that triggers growth
+	attempts   int         // attempts in the current window
+	collisions int         // collisions in the current window
+	issued     map[int]int // generated codes issued per length
+	mu         sync.Mutex
+}
+
+// KeyspaceStats represents the JSON response of the keyspace monitor
+type KeyspaceStats struct {
+	AlphabetSize     int              `json:"alphabet_size"`
+	CurrentLength    int              `json:"current_length"`
+	Threshold        float64          `json:"threshold"`
+	WindowAttempts   int              `json:"window_attempts"`
+	WindowCollisions int              `json:"window_collisions"`
+	CollisionRate    float64          `json:"collision_rate"`
+	Lengths          []KeyspaceLength `json:"lengths"`
+}
+
+// KeyspaceLength reports occupancy of the code space for a single length
+type KeyspaceLength struct {
+	Length    int     `json:"length"`
+	Issued    int     `json:"issued"`
+	Capacity  float64 `json:"capacity"`
+	Occupancy float64 `json:"occupancy"`
+}
+
+var keyspace = newKeyspaceMonitor(defaultCodeLength, defaultCollisionThreshold)
+
+func newKeyspaceMonitor(length int, threshold float64) *keyspaceMonitor {
+	return &keyspaceMonitor{
+		length:    length,
+		threshold: threshold,
+		issued:    make(map[int]int),
+	}
+}
+
+// loadCollisionThreshold reads CODE_COLLISION_THRESHOLD from the environment
+func loadCollisionThreshold() (float64, error) {
+	value := os.Getenv("CODE_COLLISION_THRESHOLD")
+	if value == "" {
+		return defaultCollisionThreshold, nil
+	}
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil || threshold <= 0 || threshold >= 1 {
+		return 0, fmt.Errorf("invalid CODE_COLLISION_THRESHOLD %q: must be between 0 and 1", value)
+	}
+	return threshold, nil
+}
+
+// currentLength returns the length to use for the next generated code
+func (k *keyspaceMonitor) currentLength() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.length
+}
+
+// record notes the outcome of one generation attempt at length, growing the
+// code length once the collision rate or occupancy crosses the threshold
+func (k *keyspaceMonitor) record(length int, collided bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if length != k.length {
+		return
+	}
+
+	k.attempts++
+	if collided {
+		k.collisions++
+	} else {
+		k.issued[length]++
+	}
+
+	if k.occupancy(length) >= k.threshold {
+		k.growLocked(fmt.Sprintf("occupancy reached %.3f", k.occupancy(length)))
+		return
+	}
+
+	if k.attempts >= collisionWindow {
+		rate := float64(k.collisions) / float64(k.attempts)
+		if rate > k.threshold {
+			k.growLocked(fmt.Sprintf("collision rate reached %.3f", rate))
+			return
+		}
+		k.attempts, k.collisions = 0, 0
+	}
+}
+
+// grow moves generation past length after repeated collisions
+func (k *keyspaceMonitor) grow(length int) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if length != k.length {
+		return true
+	}
+	return k.growLocked(fmt.Sprintf("%d consecutive collisions", maxAttemptsPerLength))
+}
+
+func (k *keyspaceMonitor) growLocked(reason string) bool {
+	if k.length >= codes.maxLength() {
+		return false
+	}
+	k.length++
+	k.attempts, k.collisions = 0, 0
+	log.Printf("Short code length increased to %d: %s", k.length, reason)
+	return true
+}
+
+// occupancy returns the fraction of codes of length already issued
+func (k *keyspaceMonitor) occupancy(length int) float64 {
+	return float64(k.issued[length]) / keyspaceCapacity(length)
+}
+
+// stats returns a snapshot of the monitor
+func (k *keyspaceMonitor) stats() KeyspaceStats {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	stats := KeyspaceStats{
+		AlphabetSize:     len(codes.Alphabet),
+		CurrentLength:    k.length,
+		Threshold:        k.threshold,
+		WindowAttempts:   k.attempts,
+		WindowCollisions: k.collisions,
+		Lengths:          []KeyspaceLength{},
+	}
+	if k.attempts > 0 {
+		stats.CollisionRate = float64(k.collisions) / float64(k.attempts)
+	}
+	for length, issued := range k.issued {
+		stats.Lengths = append(stats.Lengths, KeyspaceLength{
+			Length:    length,
+			Issued:    issued,
+			Capacity:  keyspaceCapacity(length),
+			Occupancy: k.occupancy(length),
+		})
+	}
+	sort.Slice(stats.Lengths, func(i, j int) bool {
+		return stats.Lengths[i].Length < stats.Lengths[j].Length
+	})
+
+	return stats
+}
+
+// keyspaceCapacity returns the number of distinct codes of length
+func keyspaceCapacity(length int) float64 {
+	return math.Pow(float64(len(codes.Alphabet)), float64(length))
+}
+
+// randomCode returns a uniformly random code of length drawn from the
+// configured alphabet. Bytes that would bias the result towards the start
+// of the alphabet are rejected and redrawn.
+func randomCode(length int) (string, error) {
+	alphabet := codes.Alphabet
+	limit := 256 - 256%len(alphabet)
+
+	code := make([]byte, 0, length)
+	buf := make([]byte, length+length/2)
+	for len(code) < length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+			code = append(code, alphabet[int(b)%len(alphabet)])
+			if len(code) == length {
+				break
+			}
+		}
+	}
+
+	return string(code), nil
+}
+
+// handleKeyspaceStats handles GET requests for the keyspace monitor
+func handleKeyspaceStats(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET requests are supported")
+		return
+	}
+
+	sendJSONResponse(w, http.StatusOK, keyspace.stats())
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// linkInfo holds what we know about a short link besides its destination
+type linkInfo struct {
+	Owner        string
+	CreatedAt    time.Time
+	Warning      string // why the destination looks suspicious, if it does
+	Interstitial bool   // show the interstitial page before redirecting
+	Clicks       int64  // redirects actually followed
+	PasswordHash string // set for password-protected links, see hashPassword
+	Signed       bool   // only reachable through a signed URL, see signLink
+}
+
+var (
+	// dedupeURLs returns a caller's existing code when they shorten the same
+	// URL again without a custom code
+	dedupeURLs bool
+
+	// trustProxyHeaders takes the client address from X-Forwarded-For, for
+	// deployments behind a reverse proxy
+	trustProxyHeaders bool
+)
+
+// saveLink stores a new short link and indexes plain links by owner and
+// destination. It reports false, storing nothing, if code was taken since
+// the caller checked it.
+func saveLink(code, destination string, info *linkInfo) bool {
+	info.CreatedAt = time.Now()
+
+	store.mu.Lock()
+	if _, exists := store.urls[code]; exists {
+		store.mu.Unlock()
+		return false
+	}
+	store.urls[code] = destination
+	if codeFilter.add(code) {
+		codeFilter.grow(store.urls)
+	}
+	store.meta[code] = info
+	// Only plain links are handed out again; a protected, signed or
+	// interstitial link would not behave like the one asked for
+	key := dedupeKey(info.Owner, destination)
+	if _, exists := store.byURL[key]; !exists && info.PasswordHash == "" && !info.Signed && !info.Interstitial {
+		store.byURL[key] = code
+	}
+	store.mu.Unlock()
+
+	// Drop any QR renderings made for a previous destination of this code
+	qrCache.invalidate(code)
+	return true
+}
+
+// linkDetails returns a copy of the metadata stored for a code
+func linkDetails(code string) (linkInfo, bool) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	info, exists := store.meta[code]
+	if !exists {
+		return linkInfo{}, false
+	}
+	return *info, true
+}
+
+// recordClick counts a redirect through a code
+func recordClick(code string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if info, exists := store.meta[code]; exists {
+		info.Clicks++
+	}
+}
+
+// findOwnedLink returns the code owner already uses for destination
+func findOwnedLink(owner, destination string) (string, bool) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	code, exists := store.byURL[dedupeKey(owner, destination)]
+	return code, exists
+}
+
+func dedupeKey(owner, destination string) string {
+	return owner + "\x00" + destination
+}
+
+// callerID identifies who is making a request: the API key if one is sent,
+// otherwise the client address
+func callerID(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:8])
+	}
+	return "ip:" + clientIP(r)
+}
+
+// clientIP returns the address of the client, honoring X-Forwarded-For only
+// when the service is configured to trust its proxy. Only the last entry,
+// appended by that proxy, is used; earlier ones are whatever the client sent.
+func clientIP(r *http.Request) string {
+	if trustProxyHeaders {
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			entries := strings.Split(values[len(values)-1], ",")
+			if last := strings.TrimSpace(entries[len(entries)-1]); last != "" {
+				return last
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -1,51 +1,59 @@
 package main
 
 import (
-	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
-
-	"github.com/skip2/go-qrcode"
+	"time"
 )
 
 // URLStore represents our in-memory storage
 type URLStore struct {
-	urls map[string]string
-	mu   sync.RWMutex
+	urls  map[string]string
+	meta  map[string]*linkInfo
+	byURL map[string]string // owner and destination to code, for dedupe
+	mu    sync.RWMutex
 }
 
 // ShortenRequest represents the JSON request for shortening a URL
 type ShortenRequest struct {
 	URL        string `json:"url"`
 	CustomCode string `json:"custom_code,omitempty"`
+	Generator  string `json:"generator,omitempty"`  // "random" (default) or "words"
+	WordCount  int    `json:"word_count,omitempty"` // words in a "words" code
+
+	Interstitial bool   `json:"interstitial,omitempty"` // show a warning page before redirecting
+	Password     string `json:"password,omitempty"`     // visitors must enter it to follow the link
+	Signed       bool   `json:"signed,omitempty"`       // only reachable through a signed URL
+	ExpiresIn    int64  `json:"expires_in,omitempty"`   // lifetime of the signed URL in seconds
 }
 
 // ShortenResponse represents the JSON response for shortening a URL
 type ShortenResponse struct {
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // when a signed short URL stops working
 }
 
 // ErrorResponse represents error responses
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
+	Error       string   `json:"error"`
+	Message     string   `json:"message"`
+	Suggestions []string `json:"suggestions,omitempty"`
 }
 
 var store = &URLStore{
-	urls: make(map[string]string),
+	urls:  make(map[string]string),
+	meta:  make(map[string]*linkInfo),
+	byURL: make(map[string]string),
 }
 
-const (
-	codeLength = 6
-)
-
 var baseURL string
 
 func main() {
@@ -61,19 +69,132 @@ func main() {
 		baseURL = "http://localhost:" + port
 	}
 
-	http.HandleFunc("/shorten", handleShorten)
-	http.HandleFunc("/qr/", handleQRCode)
-	http.HandleFunc("/favicon.ico", handleFavicon)
-	http.HandleFunc("/", handleRedirect)
+	// Shortening the same URL twice can return the existing code
+	dedupeURLs = os.Getenv("DEDUPE_URLS") == "true"
+	trustProxyHeaders = os.Getenv("TRUST_PROXY_HEADERS") == "true"
+
+	// Codes can be matched regardless of case, e.g. when retyped from print
+	caseInsensitiveCodes = os.Getenv("CASE_INSENSITIVE_CODES") == "true"
+
+	// Configure the length and alphabet of generated short codes
+	cfg, err := loadCodeConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	codes = cfg
+
+	threshold, err := loadCollisionThreshold()
+	if err != nil {
+		log.Fatal(err)
+	}
+	keyspace = newKeyspaceMonitor(codes.Length, threshold)
+
+	if sequence, err = loadSequenceGenerator(); err != nil {
+		log.Fatal(err)
+	}
+
+	if profanity, err = loadProfanityFilter(); err != nil {
+		log.Fatal(err)
+	}
+
+	if wordCount, err = loadWordCount(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Recognize links to this service and its alias domains
+	if selfLinks, err = loadSelfLinkConfig(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Configure which destinations are accepted
+	if urlPolicy, err = loadValidationPolicy(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Configure lookalike domain detection
+	if homographs, err = loadHomographConfig(); err != nil {
+		log.Fatal(err)
+	}
+
+	if interstitialCountdown, err = loadInterstitialCountdown(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Signing key for the cookies that remember a link password
+	if err := loadAccessCookieConfig(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Keys for links that only work with a signature
+	if err := loadSigningKeys(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Slow down and block clients that probe for codes
+	if err := loadScanDetector(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Configure which optional URL canonicalization steps to apply
+	if canonical, err = loadCanonicalOptions(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Reserved codes can be reloaded at runtime with SIGHUP
+	if err := loadReservedCodes(); err != nil {
+		log.Fatalf("Failed to load reserved codes: %v", err)
+	}
+	onReload(reserved.reload)
+
+	// Destination domain rules can be reloaded the same way
+	if err := loadDomainPolicy(); err != nil {
+		log.Fatalf("Failed to load domain policy: %v", err)
+	}
+	onReload(destinations.reload)
+	watchReloadSignal()
+
+	// Admin endpoints stay disabled unless a token is configured
+	adminToken = os.Getenv("ADMIN_TOKEN")
+
+	// Size the QR code cache (0 disables caching)
+	if size := os.Getenv("QR_CACHE_SIZE"); size != "" {
+		capacity, err := strconv.Atoi(size)
+		if err != nil || capacity < 0 {
+			log.Fatalf("Invalid QR_CACHE_SIZE: %q", size)
+		}
+		qrCache = newQRImageCache(capacity)
+	}
+
+	handleRoute("/shorten", csrfProtected(handleShorten))
+	handleRoute("/qr/", handleQRCode)
+	handleRoute("/api/qr/sheet", handleQRSheet)
+	handleRoute("/api/qr/payload", handleQRPayload)
+	handleRoute("/api/codes/", handleCodes)
+	handleRoute("/api/links/", csrfProtected(handleLinks))
+	handleRoute("/api/admin/keyspace", handleKeyspaceStats)
+	handleRoute("/api/admin/codes/", handleAdminCode)
+	handleRoute("/api/admin/reserved", handleReserved)
+	handleRoute("/static/", handleStatic)
+	handleRoute("/favicon.ico", handleFavicon)
+	handleRoute("/", handleRedirect)
 
 	fmt.Printf("URL Shortener running on %s\n", baseURL)
 	fmt.Println("Usage:")
 	fmt.Println("  POST /shorten - Shorten a URL")
 	fmt.Println("  GET /{code}   - Redirect to original URL")
-	fmt.Println("  GET /qr/{code} - Get QR code for short URL")
+	fmt.Println("  GET /qr/{code} - Get QR code for short URL (?format=text for terminals)")
+	fmt.Println("  GET /api/qr/sheet?codes=a,b - Printable PDF sheet of QR labels")
+	fmt.Println("  POST /api/qr/payload - QR code for Wi-Fi, contact, event, geo or email")
+	fmt.Println("  GET /api/codes/{code}/available - Check a custom code and suggest alternatives")
+	fmt.Println("  POST /api/links/{code}/sign - Mint a signed URL for a signed link (owner or admin)")
+	fmt.Println("  GET /api/admin/keyspace - Short code keyspace occupancy (admin)")
+	fmt.Println("  GET /api/admin/codes/{code} - Decode a sequential code to its ID (admin)")
+	fmt.Println("  GET|POST /api/admin/reserved - View or reload reserved codes (admin)")
+	fmt.Println("  GET /{code}+ or /{code}/preview - Preview a link without redirecting")
+	fmt.Println("  GET /static/{file} - Fonts, icons and stylesheets")
 	fmt.Println("  GET /favicon.ico - Favicon")
 	
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	log.Fatal(http.ListenAndServe(":"+port, withSecurityHeaders(http.DefaultServeMux)))
 }
 
 // handleShorten handles POST requests to shorten URLs
@@ -103,62 +224,173 @@ func handleShorten(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate URL
-	if !isValidURL(req.URL) {
-		sendErrorResponse(w, http.StatusBadRequest, "Invalid URL", "URL must be a valid HTTP or HTTPS URL")
+	// Our own short URLs are rejected or followed to their final target,
+	// before the policy would reject them as e.g. a local host
+	if selfLinks.isOwnHost(req.URL) && rejectBlockedClient(w, r) {
+		return
+	}
+	destination, reason, unknown := selfLinks.resolve(req.URL)
+	if unknown && !recordMiss(r) {
+		return
+	}
+	if reason != "" {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid URL", reason)
+		return
+	}
+
+	// Validate URL against the destination policy
+	if reason := validateURL(destination, urlPolicy); reason != "" {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid URL", reason)
 		return
 	}
 
 	// Sanitize URL
-	sanitizedURL := sanitizeURL(req.URL)
+	sanitizedURL := sanitizeURL(destination)
+
+	// Enforce the domain blocklist or allowlist
+	if reason := destinations.check(sanitizedURL); reason != "" {
+		sendErrorResponse(w, http.StatusForbidden, "Destination not allowed", reason)
+		log.Printf("Rejected destination: %s (%s)", sanitizedURL, reason)
+		return
+	}
+
+	// Lookalike hosts are rejected, or stored with a warning for the
+	// interstitial page
+	warning := homographs.check(hostOf(sanitizedURL))
+	if warning != "" {
+		log.Printf("Suspicious destination: %s (%s)", sanitizedURL, warning)
+		if homographs.Action == homographReject {
+			sendErrorResponse(w, http.StatusBadRequest, "Suspicious URL", warning)
+			return
+		}
+	}
 
 	var shortCode string
 	var err error
 
-	// Use custom code if provided, otherwise generate random code
-	if req.CustomCode != "" {
-		// Validate custom code
-		if !isValidCustomCode(req.CustomCode) {
-			sendErrorResponse(w, http.StatusBadRequest, "Invalid custom code", "Custom code must be 3-20 characters, alphanumeric and hyphens only")
+	// Reuse the caller's existing code for this URL if dedupe is enabled
+	owner := callerID(r)
+	if dedupeURLs && req.CustomCode == "" && req.Generator == "" && req.Password == "" && !req.Interstitial && !req.Signed {
+		if existing, found := findOwnedLink(owner, sanitizedURL); found {
+			sendJSONResponse(w, http.StatusOK, ShortenResponse{
+				ShortURL:    fmt.Sprintf("%s/%s", baseURL, existing),
+				OriginalURL: sanitizedURL,
+			})
+			log.Printf("Reused existing code: %s -> %s", sanitizedURL, existing)
 			return
 		}
+	}
+
+	// A custom code and a generator are mutually exclusive
+	if req.CustomCode != "" && req.Generator != "" {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request", "Specify either custom_code or generator, not both")
+		return
+	}
 
-		// Check if custom code is reserved
-		if isReservedCode(req.CustomCode) {
-			sendErrorResponse(w, http.StatusBadRequest, "Reserved code", "This custom code is reserved and cannot be used")
+	if len(req.Password) > maxPasswordLength {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid password", fmt.Sprintf("Password must be at most %d characters long", maxPasswordLength))
+		return
+	}
+
+	// Signed links need a key to sign with and a valid lifetime
+	var expires time.Time
+	if req.Signed {
+		if len(signingKeys) == 0 {
+			sendErrorResponse(w, http.StatusBadRequest, "Not available", "Signed links are not enabled")
 			return
 		}
+		if expires, err = signedLinkExpiry(req.ExpiresIn); err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid expiry", err.Error())
+			return
+		}
+	} else if req.ExpiresIn != 0 {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request", "expires_in only applies to signed links")
+		return
+	}
 
-		// Check if custom code already exists
-		store.mu.RLock()
-		_, exists := store.urls[req.CustomCode]
-		store.mu.RUnlock()
-
-		if exists {
-			sendErrorResponse(w, http.StatusConflict, "Code already exists", "This custom code is already in use")
+	// Use custom code if provided, otherwise generate a code
+	switch {
+	case req.CustomCode != "":
+		// Validate the custom code and make sure it is free
+		if problem := checkCustomCode(req.CustomCode); problem != nil {
+			if problem.Status == http.StatusConflict {
+				sendConflictResponse(w, problem, suggestCodes(req.CustomCode))
+				return
+			}
+			sendErrorResponse(w, problem.Status, problem.Error, problem.Message)
 			return
 		}
 
-		shortCode = req.CustomCode
-	} else {
+		shortCode = canonicalCode(req.CustomCode)
+	case req.Generator == "words":
+		// Generate a human-readable code such as brave-otter-42
+		if req.WordCount != 0 && (req.WordCount < minWordCount || req.WordCount > maxWordCount) {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid word count", fmt.Sprintf("word_count must be between %d and %d", minWordCount, maxWordCount))
+			return
+		}
+		shortCode, err = generateWordCode(req.WordCount)
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, "Generation failed", "Failed to generate word code")
+			return
+		}
+	case req.Generator == "" || req.Generator == "random":
 		// Generate random short code
 		shortCode, err = generateShortCode()
 		if err != nil {
 			sendErrorResponse(w, http.StatusInternalServerError, "Generation failed", "Failed to generate short code")
 			return
 		}
+	default:
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid generator", "Generator must be 'random' or 'words'")
+		return
 	}
 
-	// Store the mapping
-	store.mu.Lock()
-	store.urls[shortCode] = sanitizedURL
-	store.mu.Unlock()
+	// Only a slow hash of the password is kept
+	var passwordHash string
+	if req.Password != "" {
+		client := clientIP(r)
+		if !passwordHashing.acquire(r.Context(), client) {
+			w.Header().Set("Retry-After", "1")
+			sendErrorResponse(w, http.StatusTooManyRequests, "Too many requests", "Wait for your previous password-protected link to be created")
+			return
+		}
+		passwordHash, err = hashPassword(req.Password)
+		passwordHashing.release(client)
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, "Hashing failed", "Failed to protect link with password")
+			return
+		}
+	}
+
+	// Store the mapping, unless another request claimed the code while
+	// this one was being checked and hashed
+	stored := saveLink(shortCode, sanitizedURL, &linkInfo{
+		Owner:        owner,
+		Warning:      warning,
+		Interstitial: req.Interstitial,
+		PasswordHash: passwordHash,
+		Signed:       req.Signed,
+	})
+	if !stored {
+		problem := &codeProblem{http.StatusConflict, "Code already exists", "This code was taken while your link was being created"}
+		var suggestions []string
+		if req.CustomCode != "" {
+			suggestions = suggestCodes(req.CustomCode)
+		}
+		sendConflictResponse(w, problem, suggestions)
+		log.Printf("Lost race for code: %s", shortCode)
+		return
+	}
 
 	// Create response
 	response := ShortenResponse{
 		ShortURL:    fmt.Sprintf("%s/%s", baseURL, shortCode),
 		OriginalURL: sanitizedURL,
 	}
+	if req.Signed {
+		response.ShortURL = signLink(shortCode, expires)
+		response.ExpiresAt = &expires
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -172,39 +404,60 @@ func handleQRCode(w http.ResponseWriter, r *http.Request) {
 	// Extract short code from path
 	shortCode := strings.TrimPrefix(r.URL.Path, "/qr/")
 
+	// Clients probing for codes are turned away until their block ends
+	if rejectBlockedClient(w, r) {
+		return
+	}
+
 	// Validate short code format
 	if !isValidShortCode(shortCode) {
-		http.NotFound(w, r)
+		sendNotFound(w, r)
 		return
 	}
 
 	// Look up original URL
-	store.mu.RLock()
-	_, exists := store.urls[shortCode]
-	store.mu.RUnlock()
+	shortCode, _, exists := lookupCode(shortCode)
+	info, _ := linkDetails(shortCode)
+	if !exists || isHiddenLink(r, shortCode, info) {
+		sendNotFound(w, r)
+		log.Printf("Short code not found for QR: %s", r.URL.Path)
+		return
+	}
 
-	if !exists {
-		http.NotFound(w, r)
-		log.Printf("Short code not found for QR: %s", shortCode)
+	opts, err := parseQROptions(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid QR options", err.Error())
 		return
 	}
 
-	// Generate QR code for the short URL
+	// Generate QR code for the short URL, reusing a cached rendering if we have one
 	shortURL := fmt.Sprintf("%s/%s", baseURL, shortCode)
-	qrCode, err := qrcode.Encode(shortURL, qrcode.Medium, 256)
+	if info.Signed {
+		shortURL += "?" + signatureParams(r).Encode()
+	}
+	qrImage, err := getQRImage(qrCacheKey{Code: shortCode, Content: shortURL, Options: opts})
 	if err != nil {
 		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
 		log.Printf("QR code generation failed: %v", err)
 		return
 	}
 
-	// Set headers for PNG image
-	w.Header().Set("Content-Type", "image/png")
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(qrCode)))
+	w.Header().Set("ETag", qrImage.ETag)
 	w.Header().Set("Cache-Control", "public, max-age=3600") // Cache for 1 hour
+	w.Header().Set("Vary", "Accept")                        // Format may follow the Accept header
+
+	// Let clients revalidate without downloading the image again
+	if etagMatches(r.Header.Get("If-None-Match"), qrImage.ETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// Set headers for the image
+	w.Header().Set("Content-Type", qrImage.ContentType)
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(qrImage.Data)))
 
 	// Write QR code image
-	w.Write(qrCode)
+	w.Write(qrImage.Data)
 	log.Printf("QR code generated for: %s", shortCode)
 }
 
@@ -233,29 +486,80 @@ func handleRedirect(w http.ResponseWriter, r *http.Request) {
 
 	// Handle root path
 	if shortCode == "" {
-		sendHTMLResponse(w, http.StatusOK, getHomePage())
+		sendHTMLResponse(w, http.StatusOK, getHomePage(cspNonce(r), csrfToken(w, r)))
+		return
+	}
+
+	// Clients probing for codes are turned away until their block ends
+	if rejectBlockedClient(w, r) {
 		return
 	}
 
+	// A "+" or "/preview" suffix asks for the preview page
+	shortCode, preview := splitPreviewSuffix(shortCode)
+
 	// Validate short code format
 	if !isValidShortCode(shortCode) {
-		http.NotFound(w, r)
+		sendNotFound(w, r)
 		return
 	}
 
 	// Look up original URL
-	store.mu.RLock()
-	originalURL, exists := store.urls[shortCode]
-	store.mu.RUnlock()
-
+	key, originalURL, exists := lookupCode(shortCode)
 	if !exists {
-		http.NotFound(w, r)
+		sendNotFound(w, r)
 		log.Printf("Short code not found: %s", shortCode)
 		return
 	}
 
-	// Redirect to original URL
-	http.Redirect(w, r, originalURL, http.StatusMovedPermanently)
+	// Signed links without a valid signature look like they do not exist
+	info, _ := linkDetails(key)
+	if isHiddenLink(r, key, info) {
+		sendNotFound(w, r)
+		log.Printf("Missing or invalid signature: %s", shortCode)
+		return
+	}
+
+	// Destinations blocked after the link was created no longer redirect
+	if reason := destinations.check(originalURL); reason != "" {
+		http.Error(w, "This link has been disabled", http.StatusGone)
+		log.Printf("Blocked redirect: %s -> %s (%s)", shortCode, originalURL, reason)
+		return
+	}
+
+	// Protected links ask for their password before anything else,
+	// including the preview, reveals the destination
+	if info.PasswordHash != "" && !hasLinkAccess(r, key) {
+		handlePasswordGate(w, r, key, info)
+		return
+	}
+
+	// The preview page shows the link without following it
+	if preview {
+		w.Header().Set("Cache-Control", "no-store")
+		sendHTMLResponse(w, http.StatusOK, getPreviewPage(key, originalURL, info, signatureParams(r), cspNonce(r)))
+		return
+	}
+
+	// Flagged links and links created with the interstitial option show
+	// the destination first; only continuing counts as a click
+	if needsInterstitial(info) && !hasContinueToken(r, key) {
+		w.Header().Set("Cache-Control", "no-store")
+		sendHTMLResponse(w, http.StatusOK, getInterstitialPage(key, originalURL, info, signatureParams(r), cspNonce(r)))
+		log.Printf("Showed interstitial: %s -> %s", shortCode, originalURL)
+		return
+	}
+
+	// Redirect to original URL. Browsers cache permanent redirects, which
+	// would skip the password or outlive the signature or continue token
+	// next time, so protected, signed and interstitial links use 302.
+	status := http.StatusMovedPermanently
+	if info.PasswordHash != "" || info.Signed || needsInterstitial(info) {
+		w.Header().Set("Cache-Control", "no-store")
+		status = http.StatusFound
+	}
+	recordClick(key)
+	http.Redirect(w, r, originalURL, status)
 	log.Printf("Redirected: %s -> %s", shortCode, originalURL)
 }
 
@@ -286,34 +590,24 @@ func isValidURL(str string) bool {
 
 // sanitizeURL cleans and normalizes a URL
 func sanitizeURL(rawURL string) string {
-	// Parse and reconstruct URL to normalize it
-	u, err := url.Parse(rawURL)
+	canonicalURL, err := canonicalizeURL(rawURL, canonical)
 	if err != nil {
 		return rawURL
 	}
 
-	// Ensure scheme is lowercase
-	u.Scheme = strings.ToLower(u.Scheme)
-	
-	// Ensure host is lowercase
-	u.Host = strings.ToLower(u.Host)
-
-	return u.String()
+	return canonicalURL
 }
 
 // isValidShortCode validates the format of a short code
 func isValidShortCode(code string) bool {
-	// For custom codes, allow variable length
-	if len(code) < 3 || len(code) > 20 {
+	// Accept both custom codes and codes produced by the configured generator
+	if len(code) < 3 || len(code) > codes.maxLength() {
 		return false
 	}
 
-	// Check if code contains only alphanumeric characters and hyphens
+	// Check if code contains only characters a short code can be made of
 	for _, char := range code {
-		if !((char >= 'a' && char <= 'z') || 
-			 (char >= 'A' && char <= 'Z') || 
-			 (char >= '0' && char <= '9') ||
-			 char == '-') {
+		if !codes.isCodeChar(char) {
 			return false
 		}
 	}
@@ -340,10 +634,7 @@ func isValidCustomCode(code string) bool {
 
 	// Check if code contains only alphanumeric characters and hyphens
 	for _, char := range code {
-		if !((char >= 'a' && char <= 'z') || 
-			 (char >= 'A' && char <= 'Z') || 
-			 (char >= '0' && char <= '9') ||
-			 char == '-') {
+		if !isCustomCodeChar(char) {
 			return false
 		}
 	}
@@ -353,58 +644,49 @@ func isValidCustomCode(code string) bool {
 
 // isReservedCode checks if a code is reserved and cannot be used
 func isReservedCode(code string) bool {
-	reserved := []string{
-		"admin", "api", "www", "ftp", "mail", "email", "support", "help",
-		"about", "contact", "terms", "privacy", "legal", "blog", "news",
-		"docs", "documentation", "download", "downloads", "upload", "uploads",
-		"static", "assets", "css", "js", "img", "images", "favicon",
-		"robots", "sitemap", "feed", "rss", "atom", "xml", "json",
-		"login", "logout", "signin", "signup", "register", "auth",
-		"dashboard", "profile", "account", "settings", "config",
-		"test", "testing", "dev", "development", "staging", "prod", "production",
-		"qr", "shorten", "short", "url", "link", "redirect",
-	}
-
-	lowerCode := strings.ToLower(code)
-	for _, reservedWord := range reserved {
-		if lowerCode == reservedWord {
-			return true
-		}
-	}
-
-	return false
+	return reserved.matches(code)
 }
 
-// generateShortCode generates a random short code
+// generateShortCode generates a random short code, moving to longer codes
+// whenever the current length is too crowded to find a free one
 func generateShortCode() (string, error) {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	
-	for attempts := 0; attempts < 10; attempts++ {
-		code := make([]byte, codeLength)
-		
-		// Generate random bytes
-		if _, err := rand.Read(code); err != nil {
-			return "", err
-		}
+	// Sequential codes cannot collide, so they bypass the keyspace monitor
+	if sequence != nil {
+		return sequence.nextCode()
+	}
 
-		// Convert to charset
-		for i := range code {
-			code[i] = charset[int(code[i])%len(charset)]
+	for {
+		length := keyspace.currentLength()
+		filtered := 0
+
+		for attempts := 0; attempts < maxAttemptsPerLength; attempts++ {
+			shortCode, err := randomCode(length)
+			if err != nil {
+				return "", err
+			}
+
+			// Regenerate codes that spell something offensive or reserved
+			if profanity.contains(shortCode) || isReservedCode(shortCode) {
+				filtered++
+				continue
+			}
+
+			// Check for collision
+			_, _, exists := lookupCode(shortCode)
+			keyspace.record(length, exists)
+			if !exists {
+				return shortCode, nil
+			}
 		}
 
-		shortCode := string(code)
-
-		// Check for collision
-		store.mu.RLock()
-		_, exists := store.urls[shortCode]
-		store.mu.RUnlock()
-
-		if !exists {
-			return shortCode, nil
+		// Longer codes will not help if the reserved patterns match them all
+		if filtered == maxAttemptsPerLength {
+			return "", fmt.Errorf("every generated short code of length %d was reserved or filtered", length)
+		}
+		if !keyspace.grow(length) {
+			return "", fmt.Errorf("failed to generate unique short code of length %d", length)
 		}
 	}
-
-	return "", fmt.Errorf("failed to generate unique short code after 10 attempts")
 }
 
 // sendErrorResponse sends a JSON error response
@@ -421,6 +703,24 @@ func sendErrorResponse(w http.ResponseWriter, statusCode int, error, message str
 	log.Printf("Error response: %d - %s: %s", statusCode, error, message)
 }
 
+// sendConflictResponse sends a 409 error response listing available
+// alternatives to the requested code
+func sendConflictResponse(w http.ResponseWriter, problem *codeProblem, suggestions []string) {
+	sendJSONResponse(w, http.StatusConflict, ErrorResponse{
+		Error:       problem.Error,
+		Message:     problem.Message,
+		Suggestions: suggestions,
+	})
+	log.Printf("Error response: %d - %s: %s (suggested %v)", http.StatusConflict, problem.Error, problem.Message, suggestions)
+}
+
+// sendJSONResponse sends a JSON success response
+func sendJSONResponse(w http.ResponseWriter, statusCode int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
+
 // sendHTMLResponse sends an HTML response
 func sendHTMLResponse(w http.ResponseWriter, statusCode int, html string) {
 	w.Header().Set("Content-Type", "text/html")
@@ -428,17 +728,20 @@ func sendHTMLResponse(w http.ResponseWriter, statusCode int, html string) {
 	w.Write([]byte(html))
 }
 
-// getHomePage returns a modern HTML page for testing
-func getHomePage() string {
+// getHomePage returns a modern HTML page for testing. nonce lets its inline
+// style and script run under the Content-Security-Policy; csrfToken is
+// sent back with the shorten request.
+func getHomePage(nonce, csrfToken string) string {
 	return `<!DOCTYPE html>
 <html lang="en">
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
     <title>QuickLink - URL Shortener</title>
-    <link href="https://fonts.googleapis.com/css2?family=Inter:wght@300;400;500;600;700&display=swap" rel="stylesheet">
-    <link href="https://cdnjs.cloudflare.com/ajax/libs/font-awesome/6.0.0/css/all.min.css" rel="stylesheet">
-    <style>
+    <link href="/static/css/inter.css" rel="stylesheet">
+    <link href="/static/css/fontawesome.css" rel="stylesheet">
+    <meta name="csrf-token" content="` + csrfToken + `">
+    <style nonce="` + nonce + `">
         * {
             margin: 0;
             padding: 0;
@@ -991,7 +1294,7 @@ func getHomePage() string {
                         <div class="input-group">
                             <i class="fas fa-edit input-icon"></i>
                             <input type="text" id="customCodeInput" placeholder="my-custom-code (optional)" maxlength="20">
-                            <small class="input-hint">3-20 characters, letters, numbers, and hyphens only</small>
+                            <small class="input-hint" id="customCodeHint">3-20 characters, letters, numbers, and hyphens only</small>
                         </div>
                         <button type="submit" class="shorten-btn">
                             <i class="fas fa-magic"></i>
@@ -1031,7 +1334,7 @@ func getHomePage() string {
         </footer>
     </div>
 
-    <script>
+    <script nonce="` + nonce + `">
         document.getElementById('shortenForm').addEventListener('submit', async function(e) {
             e.preventDefault();
             
@@ -1056,6 +1359,7 @@ func getHomePage() string {
                     method: 'POST',
                     headers: {
                         'Content-Type': 'application/json',
+                        'X-CSRF-Token': document.querySelector('meta[name="csrf-token"]').content,
                     },
                     body: JSON.stringify(requestBody)
                 });
@@ -1073,7 +1377,7 @@ func getHomePage() string {
                                 '<strong><i class="fas fa-check-circle"></i> Success! Your shortened URL:</strong>' +
                                 '<div class="url-container">' +
                                     '<a href="' + data.short_url + '" target="_blank" class="short-url">' + data.short_url + '</a>' +
-                                    '<button class="copy-btn" onclick="copyToClipboard(\'' + data.short_url + '\')">' +
+                                    '<button type="button" class="copy-btn">' +
                                         '<i class="fas fa-copy"></i>' +
                                     '</button>' +
                                 '</div>' +
@@ -1085,7 +1389,7 @@ func getHomePage() string {
                                     '<div class="qr-container">' +
                                         '<img src="' + qrUrl + '" alt="QR Code" class="qr-code" loading="lazy">' +
                                         '<div class="qr-actions">' +
-                                            '<button class="qr-download-btn" onclick="downloadQR(\'' + qrUrl + '\', \'' + shortCode + '\')">' +
+                                            '<button type="button" class="qr-download-btn">' +
                                                 '<i class="fas fa-download"></i> Download' +
                                             '</button>' +
                                         '</div>' +
@@ -1093,8 +1397,20 @@ func getHomePage() string {
                                 '</div>' +
                             '</div>' +
                         '</div>';
+                    
+                    // Inline handlers are blocked by the Content-Security-Policy
+                    resultDiv.querySelector('.copy-btn').addEventListener('click', function() {
+                        copyToClipboard(data.short_url);
+                    });
+                    resultDiv.querySelector('.qr-download-btn').addEventListener('click', function() {
+                        downloadQR(qrUrl, shortCode);
+                    });
                 } else {
-                    resultDiv.innerHTML = '<div class="error"><strong><i class="fas fa-exclamation-triangle"></i> Error:</strong> ' + data.message + '</div>';
+                    let message = data.message;
+                    if (data.suggestions && data.suggestions.length) {
+                        message += '. Available: ' + data.suggestions.join(', ');
+                    }
+                    resultDiv.innerHTML = '<div class="error"><strong><i class="fas fa-exclamation-triangle"></i> Error:</strong> ' + message + '</div>';
                 }
             } catch (error) {
                 resultDiv.innerHTML = '<div class="error"><strong><i class="fas fa-exclamation-triangle"></i> Error:</strong> Failed to shorten URL. Please try again.</div>';
@@ -1175,11 +1491,41 @@ func getHomePage() string {
             }
         });
         
+        // Check custom code availability while typing
+        const defaultHint = document.getElementById('customCodeHint').textContent;
+        let availabilityTimer;
+        
         document.getElementById('customCodeInput').addEventListener('input', function() {
             const resultDiv = document.getElementById('result');
             if (resultDiv.innerHTML) {
                 resultDiv.innerHTML = '';
             }
+            
+            const hint = document.getElementById('customCodeHint');
+            const code = this.value.trim();
+            clearTimeout(availabilityTimer);
+            if (code.length < 3) {
+                hint.textContent = defaultHint;
+                return;
+            }
+            
+            availabilityTimer = setTimeout(async function() {
+                try {
+                    const response = await fetch('/api/codes/' + encodeURIComponent(code) + '/available');
+                    const data = await response.json();
+                    if (data.available) {
+                        hint.textContent = '✓ "' + code + '" is available';
+                    } else {
+                        let text = '✗ ' + data.reason;
+                        if (data.suggestions && data.suggestions.length) {
+                            text += '. Try: ' + data.suggestions.join(', ');
+                        }
+                        hint.textContent = text;
+                    }
+                } catch (error) {
+                    hint.textContent = defaultHint;
+                }
+            }, 300);
         });
     </script>
 </body>
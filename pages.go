@@ -0,0 +1,120 @@
+package main
+
+// cardPageStyle is the look shared by the small single-card pages such as
+// the interstitial and the link preview
+const cardPageStyle = `
+        * {
+            margin: 0;
+            padding: 0;
+            box-sizing: border-box;
+        }
+
+        body {
+            font-family: 'Inter', -apple-system, BlinkMacSystemFont, sans-serif;
+            background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
+            min-height: 100vh;
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            padding: 40px 20px;
+        }
+
+        .container {
+            background: rgba(255, 255, 255, 0.95);
+            border-radius: 20px;
+            padding: 50px;
+            box-shadow: 0 20px 40px rgba(0, 0, 0, 0.1);
+            max-width: 600px;
+            width: 100%;
+        }
+
+        h1 {
+            color: #333;
+            font-size: 1.6rem;
+            font-weight: 600;
+            margin-bottom: 15px;
+        }
+
+        p {
+            color: #555;
+            line-height: 1.6;
+            margin-bottom: 20px;
+        }
+
+        .destination {
+            background: #f7f7fb;
+            border: 2px solid #e1e5e9;
+            border-radius: 10px;
+            padding: 15px;
+            font-family: monospace;
+            font-size: 0.95rem;
+            color: #333;
+            word-break: break-all;
+            margin-bottom: 25px;
+        }
+
+        .actions {
+            display: flex;
+            gap: 15px;
+            flex-wrap: wrap;
+        }
+
+        .btn {
+            display: inline-block;
+            padding: 14px 28px;
+            border-radius: 10px;
+            font-size: 1rem;
+            font-weight: 600;
+            text-decoration: none;
+            transition: transform 0.2s ease;
+        }
+
+        .btn:hover {
+            transform: translateY(-2px);
+        }
+
+        .btn-primary {
+            background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
+            color: white;
+        }
+
+        .btn-secondary {
+            background: #edf2f7;
+            color: #333;
+        }
+
+        .warning h1 {
+            color: #c53030;
+        }
+
+        .warning .destination {
+            border-color: #feb2b2;
+            background: #fff5f5;
+        }
+
+        .warning .btn-primary {
+            background: #c53030;
+        }
+`
+
+// cardPage wraps body in the single-card page layout. title and head are
+// inserted as-is, so the caller escapes anything user-supplied. nonce is
+// the Content-Security-Policy nonce for the page's inline style, and for
+// any inline script in body.
+func cardPage(nonce, title, head, style, body string) string {
+	return `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="robots" content="noindex">
+    ` + head + `
+    <title>` + title + ` - QuickLink</title>
+    <link href="/static/css/inter.css" rel="stylesheet">
+    <style nonce="` + nonce + `">` + cardPageStyle + style + `    </style>
+</head>
+<body>
+` + body + `
+</body>
+</html>`
+}
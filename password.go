@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// passwordIterations follows the current OWASP recommendation for
+	// PBKDF2-HMAC-SHA256; the count is stored with each hash
+	passwordIterations = 600000
+	passwordSaltSize   = 16
+	passwordKeySize    = 32
+	maxPasswordLength  = 256
+
+	// After maxPasswordFailures wrong passwords within passwordFailureWindow
+	// a code accepts no more attempts until the window has passed
+	maxPasswordFailures   = 5
+	passwordFailureWindow = 15 * time.Minute
+
+	defaultAccessCookieTTL = 30 * time.Minute
+	accessCookiePrefix     = "ql_access_"
+)
+
+var (
+	// accessCookieSecret signs the cookies that remember an entered
+	// password. A random secret means cookies end with the process.
+	accessCookieSecret []byte
+	accessCookieTTL    = defaultAccessCookieTTL
+
+	passwordFailures = &failureTracker{failures: make(map[string][]time.Time)}
+
+	// passwordHashing bounds the CPU spent on PBKDF2: one hash at a time
+	// per client, and other clients queue for one of NumCPU slots
+	passwordHashing = newHashLimiter(runtime.NumCPU())
+)
+
+// loadAccessCookieConfig reads PASSWORD_COOKIE_SECRET and
+// PASSWORD_COOKIE_TTL from the environment
+func loadAccessCookieConfig() error {
+	if secret := os.Getenv("PASSWORD_COOKIE_SECRET"); secret != "" {
+		if len(secret) < 16 {
+			return fmt.Errorf("PASSWORD_COOKIE_SECRET must be at least 16 characters")
+		}
+		accessCookieSecret = []byte(secret)
+	} else {
+		accessCookieSecret = make([]byte, 32)
+		if _, err := rand.Read(accessCookieSecret); err != nil {
+			return err
+		}
+	}
+
+	if value := os.Getenv("PASSWORD_COOKIE_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 || ttl > 24*time.Hour {
+			return fmt.Errorf("invalid PASSWORD_COOKIE_TTL %q: must be a duration up to 24h", value)
+		}
+		accessCookieTTL = ttl
+	}
+	return nil
+}
+
+// hashPassword returns a salted PBKDF2-HMAC-SHA256 hash in the form
+// "pbkdf2-sha256$iterations$salt$hash"
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := pbkdf2SHA256([]byte(password), salt, passwordIterations, passwordKeySize)
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// verifyPassword reports whether password matches a hash made by
+// hashPassword
+func verifyPassword(password, encoded string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+
+	got := pbkdf2SHA256([]byte(password), salt, iterations, len(want))
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// pbkdf2SHA256 derives a key as described in RFC 8018 section 5.2 with
+// HMAC-SHA256 as the pseudorandom function
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	blocks := (keyLen + prf.Size() - 1) / prf.Size()
+
+	var key []byte
+	var counter [4]byte
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Write(counter[:])
+		u := prf.Sum(nil)
+
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+// failureTracker counts recent wrong passwords per code
+type failureTracker struct {
+	failures map[string][]time.Time
+	mu       sync.Mutex
+}
+
+// tryAcquire reserves an attempt for code, counted as a failure until it
+// is released, so concurrent guesses cannot all slip under the limit. If no
+// attempt is left it returns how long code must wait instead.
+func (t *failureTracker) tryAcquire(code string) (time.Time, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	recent := t.prune(code)
+	if len(recent) >= maxPasswordFailures {
+		return time.Time{}, time.Until(recent[0].Add(passwordFailureWindow))
+	}
+	attempt := time.Now()
+	t.failures[code] = append(recent, attempt)
+	return attempt, 0
+}
+
+// release takes back an attempt reserved by tryAcquire that succeeded
+func (t *failureTracker) release(code string, attempt time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	recent := t.failures[code]
+	for i, at := range recent {
+		if at.Equal(attempt) {
+			t.failures[code] = append(recent[:i:i], recent[i+1:]...)
+			break
+		}
+	}
+	t.prune(code)
+}
+
+// prune drops failures older than the window. The caller holds t.mu.
+func (t *failureTracker) prune(code string) []time.Time {
+	cutoff := time.Now().Add(-passwordFailureWindow)
+	recent := t.failures[code]
+	for len(recent) > 0 && recent[0].Before(cutoff) {
+		recent = recent[1:]
+	}
+	if len(recent) == 0 {
+		delete(t.failures, code)
+		return nil
+	}
+	t.failures[code] = recent
+	return recent
+}
+
+// hashLimiter caps concurrent password hashing, overall and per client
+type hashLimiter struct {
+	slots  chan struct{}
+	active map[string]bool
+	mu     sync.Mutex
+}
+
+func newHashLimiter(size int) *hashLimiter {
+	return &hashLimiter{slots: make(chan struct{}, size), active: make(map[string]bool)}
+}
+
+// acquire waits for a hashing slot for client, reporting whether it got
+// one. A client that is already hashing is turned away rather than queued.
+// Every successful call must be paired with release.
+func (l *hashLimiter) acquire(ctx context.Context, client string) bool {
+	l.mu.Lock()
+	if l.active[client] {
+		l.mu.Unlock()
+		return false
+	}
+	l.active[client] = true
+	l.mu.Unlock()
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		l.mu.Lock()
+		delete(l.active, client)
+		l.mu.Unlock()
+		return false
+	}
+}
+
+// release returns client's hashing slot
+func (l *hashLimiter) release(client string) {
+	<-l.slots
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.active, client)
+}
+
+// accessCookieValue returns the signed cookie value granting access to code
+// until expires
+func accessCookieValue(code string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	mac := hmac.New(sha256.New, accessCookieSecret)
+	mac.Write([]byte(code + "\x00" + exp))
+	return exp + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// hasLinkAccess reports whether the request carries a valid, unexpired
+// access cookie for code
+func hasLinkAccess(r *http.Request, code string) bool {
+	cookie, err := r.Cookie(accessCookiePrefix + code)
+	if err != nil {
+		return false
+	}
+	exp, _, found := strings.Cut(cookie.Value, ".")
+	if !found {
+		return false
+	}
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return false
+	}
+	want := accessCookieValue(code, time.Unix(unix, 0))
+	return hmac.Equal([]byte(cookie.Value), []byte(want))
+}
+
+// handlePasswordGate serves the password form for a protected code and
+// checks submitted passwords. On success it sets the access cookie and
+// sends the browser back to the URL it asked for.
+func handlePasswordGate(w http.ResponseWriter, r *http.Request, code string, info linkInfo) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	if r.Method != http.MethodPost {
+		sendHTMLResponse(w, http.StatusUnauthorized, getPasswordPage("", cspNonce(r)))
+		return
+	}
+
+	client := clientIP(r)
+	if !passwordHashing.acquire(r.Context(), client) {
+		w.Header().Set("Retry-After", "1")
+		sendHTMLResponse(w, http.StatusTooManyRequests, getPasswordPage("Another password check is still running. Try again in a moment.", cspNonce(r)))
+		return
+	}
+	defer passwordHashing.release(client)
+
+	attempt, wait := passwordFailures.tryAcquire(code)
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		sendHTMLResponse(w, http.StatusTooManyRequests, getPasswordPage("Too many wrong passwords. Try again later.", cspNonce(r)))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	password := r.PostFormValue("password")
+	if !verifyPassword(password, info.PasswordHash) {
+		sendHTMLResponse(w, http.StatusUnauthorized, getPasswordPage("Wrong password.", cspNonce(r)))
+		log.Printf("Wrong password for: %s", code)
+		return
+	}
+	passwordFailures.release(code, attempt)
+
+	expires := time.Now().Add(accessCookieTTL)
+	http.SetCookie(w, &http.Cookie{
+		Name:     accessCookiePrefix + code,
+		Value:    accessCookieValue(code, expires),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(baseURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+}
+
+// getPasswordPage returns the form asking for a link's password
+func getPasswordPage(message, nonce string) string {
+	errorText := ""
+	if message != "" {
+		errorText = `<p class="error">` + html.EscapeString(message) + `</p>`
+	}
+
+	return cardPage(nonce, "Password required", "", `
+        input[type="password"] {
+            width: 100%;
+            padding: 15px;
+            border: 2px solid #e1e5e9;
+            border-radius: 10px;
+            font-size: 1rem;
+            margin-bottom: 20px;
+        }
+
+        input[type="password"]:focus {
+            outline: none;
+            border-color: #667eea;
+        }
+
+        button {
+            border: none;
+            cursor: pointer;
+        }
+
+        .error {
+            color: #c53030;
+        }
+`, `    <div class="container">
+        <h1>Password required</h1>
+        <p>This link is protected. Enter its password to continue.</p>
+        `+errorText+`
+        <form method="POST">
+            <input type="password" name="password" autocomplete="current-password" required autofocus>
+            <div class="actions">
+                <button type="submit" class="btn btn-primary">Continue</button>
+                <a class="btn btn-secondary" href="/">Go back</a>
+            </div>
+        </form>
+    </div>`)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// previewSuffixes turn a short link path into its preview page
+var previewSuffixes = []string{"+", "/preview"}
+
+// splitPreviewSuffix returns the code in a request path and whether the
+// path asks for the preview page rather than the redirect
+func splitPreviewSuffix(path string) (string, bool) {
+	for _, suffix := range previewSuffixes {
+		if code := strings.TrimSuffix(path, suffix); code != path {
+			return code, true
+		}
+	}
+	return path, false
+}
+
+// getPreviewPage returns the page describing where a short link goes.
+// params are carried over to the links it shows, e.g. the signature of a
+// signed link.
+func getPreviewPage(code, destination string, info linkInfo, params url.Values, nonce string) string {
+	escapedCode := url.PathEscape(code)
+	query := ""
+	if len(params) > 0 {
+		query = "?" + params.Encode()
+	}
+	shortURL := baseURL + "/" + escapedCode + query
+
+	created := "Unknown"
+	if !info.CreatedAt.IsZero() {
+		created = info.CreatedAt.UTC().Format("January 2, 2006 15:04 UTC")
+	}
+
+	clicks := strconv.FormatInt(info.Clicks, 10) + " clicks"
+	if info.Clicks == 1 {
+		clicks = "1 click"
+	}
+
+	warningClass, notice := "", ""
+	if info.Warning != "" {
+		warningClass = " warning"
+		notice = `<p>This destination looks like it may be imitating another site: ` + html.EscapeString(info.Warning) + `.</p>`
+	}
+
+	return cardPage(nonce, "Link preview", "", `
+        .details {
+            display: flex;
+            gap: 30px;
+            align-items: center;
+            margin-bottom: 25px;
+        }
+
+        .details dl {
+            flex: 1;
+        }
+
+        .details dt {
+            font-size: 0.8rem;
+            text-transform: uppercase;
+            letter-spacing: 0.05em;
+            color: #888;
+        }
+
+        .details dd {
+            color: #333;
+            margin-bottom: 12px;
+        }
+
+        .details img {
+            width: 140px;
+            height: 140px;
+            border-radius: 10px;
+        }
+`, `    <div class="container`+warningClass+`">
+        <h1>Link preview</h1>
+        `+notice+`
+        <div class="destination">`+html.EscapeString(destination)+`</div>
+        <div class="details">
+            <dl>
+                <dt>Short link</dt>
+                <dd>`+html.EscapeString(shortURL)+`</dd>
+                <dt>Created</dt>
+                <dd>`+created+`</dd>
+                <dt>Visits</dt>
+                <dd>`+clicks+`</dd>
+            </dl>
+            <img src="/qr/`+html.EscapeString(escapedCode+query)+`" alt="QR code for `+html.EscapeString(shortURL)+`">
+        </div>
+        <div class="actions">
+            <a class="btn btn-primary" href="/`+html.EscapeString(escapedCode+query)+`" rel="noreferrer">Visit link</a>
+            <a class="btn btn-secondary" href="/">Go back</a>
+        </div>
+    </div>`)
+}
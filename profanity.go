@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultDenylist is used when PROFANITY_FILE is not set. Short words that
+// commonly appear inside innocent ones (e.g. "ass" in "class") are left out.
+var defaultDenylist = []string{
+	"bastard", "bitch", "cunt", "dick", "fuck", "nazi", "piss",
+	"porn", "pussy", "shit", "slut", "twat", "wank", "whore",
+}
+
+// leetReplacer undoes common character substitutions before matching
+var leetReplacer = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s",
+	"7", "t", "8", "b", "9", "g", "@", "a", "$", "s", "!", "i",
+)
+
+// wordFilter matches codes against a denylist of offensive words
+type wordFilter struct {
+	words [][]letterRun
+}
+
+// letterRun is a letter and how many times it repeats in a row
+type letterRun struct {
+	char  rune
+	count int
+}
+
+var profanity = newWordFilter(defaultDenylist)
+
+// newWordFilter builds a filter from a list of words, normalizing each one
+func newWordFilter(words []string) *wordFilter {
+	f := &wordFilter{}
+	for _, word := range words {
+		if word = normalizeWord(word); word != "" {
+			f.words = append(f.words, letterRuns(word))
+		}
+	}
+	return f
+}
+
+// loadProfanityFilter reads the denylist named by PROFANITY_FILE, one word
+// per line with # comments, falling back to the built-in list
+func loadProfanityFilter() (*wordFilter, error) {
+	path := os.Getenv("PROFANITY_FILE")
+	if path == "" {
+		return newWordFilter(defaultDenylist), nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PROFANITY_FILE: %w", err)
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read PROFANITY_FILE: %w", err)
+	}
+
+	return newWordFilter(words), nil
+}
+
+// contains reports whether code contains a denied word anywhere, after
+// undoing leetspeak and ignoring separators and repeated letters
+func (f *wordFilter) contains(code string) bool {
+	// "1" is read as both "i" and "l"
+	for _, variant := range []string{normalizeWord(code), normalizeWord(strings.ReplaceAll(code, "1", "l"))} {
+		runs := letterRuns(variant)
+		for _, word := range f.words {
+			if containsRuns(runs, word) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizeWord lowercases s, undoes leetspeak and drops separators
+func normalizeWord(s string) string {
+	s = leetReplacer.Replace(strings.ToLower(s))
+	return strings.Map(func(char rune) rune {
+		if char >= 'a' && char <= 'z' {
+			return char
+		}
+		return -1
+	}, s)
+}
+
+// letterRuns splits s into runs of the same letter, so "shiiit" becomes
+// s, h, i×3, t
+func letterRuns(s string) []letterRun {
+	var runs []letterRun
+	for _, char := range s {
+		if n := len(runs); n > 0 && runs[n-1].char == char {
+			runs[n-1].count++
+		} else {
+			runs = append(runs, letterRun{char: char, count: 1})
+		}
+	}
+	return runs
+}
+
+// containsRuns reports whether word appears in s with each of its letters
+// repeated at least as often, so "piss" matches "piiisss" but not "pistachio"
+func containsRuns(s, word []letterRun) bool {
+	for start := 0; start+len(word) <= len(s); start++ {
+		matched := true
+		for i, run := range word {
+			if s[start+i].char != run.char || s[start+i].count < run.count {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	defaultQRSize      = 256
+	minQRSize          = 64
+	maxQRSize          = 1024
+	defaultQRCacheSize = 256
+)
+
+// QR output formats
+const (
+	qrFormatPNG  = "png"
+	qrFormatText = "text"
+)
+
+// qrOptions holds the rendering options that can be requested for a QR code
+type qrOptions struct {
+	Size   int
+	Level  qrcode.RecoveryLevel
+	Format string
+	Invert bool // text format only: draw dark modules as blocks for light terminals
+}
+
+// qrCacheKey identifies a rendered QR image. Content is the encoded short
+// URL, so a change of host produces a different key.
+type qrCacheKey struct {
+	Code    string
+	Content string
+	Options qrOptions
+}
+
+// qrImage is a rendered QR code together with its content-addressed ETag
+type qrImage struct {
+	Data        []byte
+	ContentType string
+	ETag        string
+}
+
+type qrCacheEntry struct {
+	key   qrCacheKey
+	image *qrImage
+}
+
+// qrImageCache is an LRU cache of rendered QR codes
+type qrImageCache struct {
+	capacity int
+	ll       *list.List
+	items    map[qrCacheKey]*list.Element
+	mu       sync.Mutex
+}
+
+var qrCache = newQRImageCache(defaultQRCacheSize)
+
+func newQRImageCache(capacity int) *qrImageCache {
+	return &qrImageCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[qrCacheKey]*list.Element),
+	}
+}
+
+// get returns the cached image for key, marking it as recently used
+func (c *qrImageCache) get(key qrCacheKey) (*qrImage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+	return elem.Value.(*qrCacheEntry).image, true
+}
+
+// add stores an image, evicting the least recently used entry when full
+func (c *qrImageCache) add(key qrCacheKey, image *qrImage) {
+	if c.capacity <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*qrCacheEntry).image = image
+		c.ll.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&qrCacheEntry{key: key, image: image})
+	for c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*qrCacheEntry).key)
+	}
+}
+
+// invalidate drops every cached rendering of a short code
+func (c *qrImageCache) invalidate(code string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, elem := range c.items {
+		if key.Code == code {
+			c.ll.Remove(elem)
+			delete(c.items, key)
+		}
+	}
+}
+
+// getQRImage returns the rendered QR code for key, rendering it on a miss
+func getQRImage(key qrCacheKey) (*qrImage, error) {
+	if image, ok := qrCache.get(key); ok {
+		return image, nil
+	}
+
+	image, err := renderQR(key.Content, key.Options)
+	if err != nil {
+		return nil, err
+	}
+	qrCache.add(key, image)
+	return image, nil
+}
+
+// renderQR encodes content as a QR code in the requested format
+func renderQR(content string, opts qrOptions) (*qrImage, error) {
+	qr, err := qrcode.New(content, opts.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	image := &qrImage{}
+	switch opts.Format {
+	case qrFormatText:
+		// Unicode half blocks pack two module rows into each line of text.
+		// By default light modules are drawn, which suits dark terminals.
+		image.Data = []byte(qr.ToSmallString(opts.Invert))
+		image.ContentType = "text/plain; charset=utf-8"
+	default:
+		if image.Data, err = qr.PNG(opts.Size); err != nil {
+			return nil, err
+		}
+		image.ContentType = "image/png"
+	}
+
+	image.ETag = contentETag(image.Data)
+	return image, nil
+}
+
+// contentETag returns a strong ETag derived from the response body
+func contentETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header matches etag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseQROptions reads the size, level and format query parameters of a QR
+// request. Without ?format=, clients asking for text/plain get the text form.
+func parseQROptions(r *http.Request) (qrOptions, error) {
+	opts := qrOptions{Size: defaultQRSize, Level: qrcode.Medium, Format: qrFormatPNG}
+	query := r.URL.Query()
+
+	switch strings.ToLower(query.Get("format")) {
+	case "":
+		if acceptsTextQR(r.Header.Get("Accept")) {
+			opts.Format = qrFormatText
+		}
+	case qrFormatPNG:
+	case qrFormatText:
+		opts.Format = qrFormatText
+	default:
+		return opts, fmt.Errorf("format must be png or text")
+	}
+
+	if value := query.Get("invert"); value != "" {
+		invert, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, fmt.Errorf("invert must be true or false")
+		}
+		opts.Invert = invert
+	}
+
+	if value := query.Get("size"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < minQRSize || size > maxQRSize {
+			return opts, fmt.Errorf("size must be between %d and %d pixels", minQRSize, maxQRSize)
+		}
+		opts.Size = size
+	}
+
+	if value := query.Get("level"); value != "" {
+		switch strings.ToUpper(value) {
+		case "L":
+			opts.Level = qrcode.Low
+		case "M":
+			opts.Level = qrcode.Medium
+		case "Q":
+			opts.Level = qrcode.High
+		case "H":
+			opts.Level = qrcode.Highest
+		default:
+			return opts, fmt.Errorf("level must be one of L, M, Q or H")
+		}
+	}
+
+	return opts, nil
+}
+
+// acceptsTextQR reports whether an Accept header prefers text/plain over
+// images, so that curl's default of */* still receives a PNG
+func acceptsTextQR(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		switch strings.ToLower(mediaType) {
+		case "text/plain":
+			return true
+		case "image/png", "image/*", "*/*":
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QRPayloadRequest represents the JSON request for a structured-payload QR
+// code. Type selects which of the nested objects is used.
+type QRPayloadRequest struct {
+	Type    string          `json:"type"`
+	WiFi    *WiFiPayload    `json:"wifi,omitempty"`
+	Contact *ContactPayload `json:"contact,omitempty"`
+	Event   *EventPayload   `json:"event,omitempty"`
+	Geo     *GeoPayload     `json:"geo,omitempty"`
+	Email   *EmailPayload   `json:"email,omitempty"`
+}
+
+// WiFiPayload describes a network for the WIFI: joining scheme
+type WiFiPayload struct {
+	SSID       string `json:"ssid"`
+	Password   string `json:"password,omitempty"`
+	Encryption string `json:"encryption,omitempty"` // WPA, WEP or nopass
+	Hidden     bool   `json:"hidden,omitempty"`
+}
+
+// ContactPayload describes a contact card, encoded as vCard 3.0 or MECARD
+type ContactPayload struct {
+	Format       string `json:"format,omitempty"` // vcard (default) or mecard
+	FirstName    string `json:"first_name,omitempty"`
+	LastName     string `json:"last_name,omitempty"`
+	Organization string `json:"organization,omitempty"`
+	Title        string `json:"title,omitempty"`
+	Phone        string `json:"phone,omitempty"`
+	Email        string `json:"email,omitempty"`
+	URL          string `json:"url,omitempty"`
+	Address      string `json:"address,omitempty"`
+	Note         string `json:"note,omitempty"`
+}
+
+// EventPayload describes an iCalendar VEVENT. Start and End are RFC 3339
+// timestamps, or YYYY-MM-DD dates when AllDay is set.
+type EventPayload struct {
+	Summary     string `json:"summary"`
+	Start       string `json:"start"`
+	End         string `json:"end,omitempty"`
+	AllDay      bool   `json:"all_day,omitempty"`
+	Location    string `json:"location,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// GeoPayload describes a location as an RFC 5870 geo: URI
+type GeoPayload struct {
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Altitude  *float64 `json:"altitude,omitempty"`
+}
+
+// EmailPayload describes a message as an RFC 6068 mailto: URI
+type EmailPayload struct {
+	To      []string `json:"to"`
+	Cc      []string `json:"cc,omitempty"`
+	Subject string   `json:"subject,omitempty"`
+	Body    string   `json:"body,omitempty"`
+}
+
+// handleQRPayload handles POST requests to build a QR code from a
+// structured payload (Wi-Fi, contact, event, location or email)
+func handleQRPayload(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST requests
+	if r.Method != http.MethodPost {
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "Only POST requests are supported")
+		return
+	}
+
+	// Validate content type
+	contentType := r.Header.Get("Content-Type")
+	if !strings.Contains(contentType, "application/json") {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid content type", "Content-Type must be application/json")
+		return
+	}
+
+	opts, err := parseQROptions(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid QR options", err.Error())
+		return
+	}
+
+	// Limit request body size (64KB)
+	r.Body = http.MaxBytesReader(w, r.Body, 65536)
+
+	var req QRPayloadRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON", "Request body must be valid JSON with a 'type' field")
+		return
+	}
+
+	payload, err := buildQRPayload(req)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid payload", err.Error())
+		return
+	}
+
+	qrImage, err := renderQR(payload, opts)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Payload too large", "The payload does not fit in a QR code")
+		return
+	}
+
+	w.Header().Set("Content-Type", qrImage.ContentType)
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(qrImage.Data)))
+	w.Header().Set("ETag", qrImage.ETag)
+	w.Header().Set("Vary", "Accept")
+	w.Write(qrImage.Data)
+	log.Printf("QR payload generated: %s (%d bytes)", req.Type, len(payload))
+}
+
+// buildQRPayload encodes the request into the text stored in the QR code
+func buildQRPayload(req QRPayloadRequest) (string, error) {
+	switch strings.ToLower(req.Type) {
+	case "wifi":
+		if req.WiFi == nil {
+			return "", fmt.Errorf("'wifi' object is required for type wifi")
+		}
+		return buildWiFiPayload(*req.WiFi)
+	case "contact":
+		if req.Contact == nil {
+			return "", fmt.Errorf("'contact' object is required for type contact")
+		}
+		return buildContactPayload(*req.Contact)
+	case "event":
+		if req.Event == nil {
+			return "", fmt.Errorf("'event' object is required for type event")
+		}
+		return buildEventPayload(*req.Event, time.Now())
+	case "geo":
+		if req.Geo == nil {
+			return "", fmt.Errorf("'geo' object is required for type geo")
+		}
+		return buildGeoPayload(*req.Geo)
+	case "email":
+		if req.Email == nil {
+			return "", fmt.Errorf("'email' object is required for type email")
+		}
+		return buildEmailPayload(*req.Email)
+	default:
+		return "", fmt.Errorf("type must be one of wifi, contact, event, geo or email")
+	}
+}
+
+// buildWiFiPayload produces a WIFI:T:WPA;S:ssid;P:password;; string
+func buildWiFiPayload(p WiFiPayload) (string, error) {
+	if p.SSID == "" {
+		return "", fmt.Errorf("ssid is required")
+	}
+
+	var encryption string
+	switch strings.ToUpper(p.Encryption) {
+	case "", "WPA", "WPA2", "WPA3":
+		encryption = "WPA"
+	case "WEP":
+		encryption = "WEP"
+	case "NOPASS", "NONE":
+		encryption = "nopass"
+	default:
+		return "", fmt.Errorf("encryption must be WPA, WEP or nopass")
+	}
+	if encryption != "nopass" && p.Password == "" {
+		return "", fmt.Errorf("password is required for %s networks", encryption)
+	}
+
+	var b strings.Builder
+	b.WriteString("WIFI:T:" + encryption)
+	b.WriteString(";S:" + escapeWiFi(p.SSID))
+	if encryption != "nopass" {
+		b.WriteString(";P:" + escapeWiFi(p.Password))
+	}
+	if p.Hidden {
+		b.WriteString(";H:true")
+	}
+	b.WriteString(";;")
+	return b.String(), nil
+}
+
+// escapeWiFi escapes the characters that are special in WIFI: fields
+func escapeWiFi(s string) string {
+	return backslashEscape(s, `\;,:"`)
+}
+
+// buildContactPayload produces a vCard 3.0 or MECARD contact
+func buildContactPayload(p ContactPayload) (string, error) {
+	if p.FirstName == "" && p.LastName == "" && p.Organization == "" {
+		return "", fmt.Errorf("a name or organization is required")
+	}
+	if p.Email != "" {
+		if _, err := mail.ParseAddress(p.Email); err != nil {
+			return "", fmt.Errorf("email is not a valid address")
+		}
+	}
+
+	switch strings.ToLower(p.Format) {
+	case "", "vcard":
+		return buildVCard(p), nil
+	case "mecard":
+		return buildMeCard(p), nil
+	default:
+		return "", fmt.Errorf("format must be vcard or mecard")
+	}
+}
+
+func buildVCard(p ContactPayload) string {
+	fullName := strings.TrimSpace(p.FirstName + " " + p.LastName)
+	if fullName == "" {
+		fullName = p.Organization
+	}
+
+	lines := []string{
+		"BEGIN:VCARD",
+		"VERSION:3.0",
+		"N:" + escapeText(p.LastName) + ";" + escapeText(p.FirstName) + ";;;",
+		"FN:" + escapeText(fullName),
+	}
+	if p.Organization != "" {
+		lines = append(lines, "ORG:"+escapeText(p.Organization))
+	}
+	if p.Title != "" {
+		lines = append(lines, "TITLE:"+escapeText(p.Title))
+	}
+	if p.Phone != "" {
+		lines = append(lines, "TEL;TYPE=VOICE:"+escapeText(p.Phone))
+	}
+	if p.Email != "" {
+		lines = append(lines, "EMAIL;TYPE=INTERNET:"+escapeText(p.Email))
+	}
+	if p.URL != "" {
+		lines = append(lines, "URL:"+stripLineBreaks(p.URL))
+	}
+	if p.Address != "" {
+		lines = append(lines, "ADR:;;"+escapeText(p.Address)+";;;;")
+	}
+	if p.Note != "" {
+		lines = append(lines, "NOTE:"+escapeText(p.Note))
+	}
+	lines = append(lines, "END:VCARD")
+
+	return joinContentLines(lines)
+}
+
+func buildMeCard(p ContactPayload) string {
+	var b strings.Builder
+	b.WriteString("MECARD:")
+
+	name := escapeMeCard(p.LastName)
+	if p.FirstName != "" {
+		name += "," + escapeMeCard(p.FirstName)
+	}
+	if name == "" {
+		name = escapeMeCard(p.Organization)
+	}
+	b.WriteString("N:" + name + ";")
+
+	fields := []struct{ key, value string }{
+		{"ORG", p.Organization},
+		{"TITLE", p.Title},
+		{"TEL", p.Phone},
+		{"EMAIL", p.Email},
+		{"URL", p.URL},
+		{"ADR", p.Address},
+		{"NOTE", p.Note},
+	}
+	for _, field := range fields {
+		if field.value != "" {
+			b.WriteString(field.key + ":" + escapeMeCard(field.value) + ";")
+		}
+	}
+	b.WriteString(";")
+	return b.String()
+}
+
+// escapeMeCard escapes the characters that are special in MECARD fields
+func escapeMeCard(s string) string {
+	return backslashEscape(stripLineBreaks(s), `\;,:`)
+}
+
+// buildEventPayload produces an iCalendar object holding a single VEVENT
+func buildEventPayload(p EventPayload, now time.Time) (string, error) {
+	if p.Summary == "" {
+		return "", fmt.Errorf("summary is required")
+	}
+
+	var dtStart, dtEnd string
+	if p.AllDay {
+		start, err := time.Parse("2006-01-02", p.Start)
+		if err != nil {
+			return "", fmt.Errorf("start must be a YYYY-MM-DD date for all-day events")
+		}
+		end := start.AddDate(0, 0, 1)
+		if p.End != "" {
+			// DTEND is exclusive, so an inclusive end date moves forward a day
+			if end, err = time.Parse("2006-01-02", p.End); err != nil {
+				return "", fmt.Errorf("end must be a YYYY-MM-DD date for all-day events")
+			}
+			end = end.AddDate(0, 0, 1)
+		}
+		if !end.After(start) {
+			return "", fmt.Errorf("end must not be before start")
+		}
+		dtStart = "DTSTART;VALUE=DATE:" + start.Format("20060102")
+		dtEnd = "DTEND;VALUE=DATE:" + end.Format("20060102")
+	} else {
+		start, err := time.Parse(time.RFC3339, p.Start)
+		if err != nil {
+			return "", fmt.Errorf("start must be an RFC 3339 timestamp")
+		}
+		end := start.Add(time.Hour)
+		if p.End != "" {
+			if end, err = time.Parse(time.RFC3339, p.End); err != nil {
+				return "", fmt.Errorf("end must be an RFC 3339 timestamp")
+			}
+		}
+		if !end.After(start) {
+			return "", fmt.Errorf("end must be after start")
+		}
+		dtStart = "DTSTART:" + start.UTC().Format("20060102T150405Z")
+		dtEnd = "DTEND:" + end.UTC().Format("20060102T150405Z")
+	}
+
+	// Derive the UID from the event itself so the same event keeps its identity
+	sum := sha256.Sum256([]byte(p.Summary + "\x00" + dtStart + "\x00" + dtEnd + "\x00" + p.Location))
+	uid := hex.EncodeToString(sum[:12]) + "@quicklink"
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//QuickLink//QR Event//EN",
+		"BEGIN:VEVENT",
+		"UID:" + uid,
+		"DTSTAMP:" + now.UTC().Format("20060102T150405Z"),
+		dtStart,
+		dtEnd,
+		"SUMMARY:" + escapeText(p.Summary),
+	}
+	if p.Location != "" {
+		lines = append(lines, "LOCATION:"+escapeText(p.Location))
+	}
+	if p.Description != "" {
+		lines = append(lines, "DESCRIPTION:"+escapeText(p.Description))
+	}
+	lines = append(lines, "END:VEVENT", "END:VCALENDAR")
+
+	return joinContentLines(lines), nil
+}
+
+// buildGeoPayload produces a geo:lat,lon[,alt] URI
+func buildGeoPayload(p GeoPayload) (string, error) {
+	if p.Latitude == nil || p.Longitude == nil {
+		return "", fmt.Errorf("latitude and longitude are required")
+	}
+	lat, lon := *p.Latitude, *p.Longitude
+	if math.IsNaN(lat) || lat < -90 || lat > 90 {
+		return "", fmt.Errorf("latitude must be between -90 and 90")
+	}
+	if math.IsNaN(lon) || lon < -180 || lon > 180 {
+		return "", fmt.Errorf("longitude must be between -180 and 180")
+	}
+
+	payload := "geo:" + strconv.FormatFloat(lat, 'f', -1, 64) + "," + strconv.FormatFloat(lon, 'f', -1, 64)
+	if p.Altitude != nil {
+		if math.IsNaN(*p.Altitude) || math.IsInf(*p.Altitude, 0) {
+			return "", fmt.Errorf("altitude must be a number")
+		}
+		payload += "," + strconv.FormatFloat(*p.Altitude, 'f', -1, 64)
+	}
+	return payload, nil
+}
+
+// buildEmailPayload produces a mailto: URI
+func buildEmailPayload(p EmailPayload) (string, error) {
+	if len(p.To) == 0 {
+		return "", fmt.Errorf("at least one 'to' address is required")
+	}
+
+	encodeAddresses := func(addresses []string) (string, error) {
+		encoded := make([]string, len(addresses))
+		for i, address := range addresses {
+			parsed, err := mail.ParseAddress(address)
+			if err != nil {
+				return "", fmt.Errorf("'%s' is not a valid email address", address)
+			}
+			// The @ separator must stay readable for mail clients
+			encoded[i] = strings.ReplaceAll(mailtoEscape(parsed.Address), "%40", "@")
+		}
+		return strings.Join(encoded, ","), nil
+	}
+
+	to, err := encodeAddresses(p.To)
+	if err != nil {
+		return "", err
+	}
+
+	var fields []string
+	if len(p.Cc) > 0 {
+		cc, err := encodeAddresses(p.Cc)
+		if err != nil {
+			return "", err
+		}
+		fields = append(fields, "cc="+cc)
+	}
+	if p.Subject != "" {
+		fields = append(fields, "subject="+mailtoEscape(stripLineBreaks(p.Subject)))
+	}
+	if p.Body != "" {
+		// Line breaks in a mailto body must be sent as CRLF
+		body := strings.ReplaceAll(strings.ReplaceAll(p.Body, "\r\n", "\n"), "\n", "\r\n")
+		fields = append(fields, "body="+mailtoEscape(body))
+	}
+
+	payload := "mailto:" + to
+	if len(fields) > 0 {
+		payload += "?" + strings.Join(fields, "&")
+	}
+	return payload, nil
+}
+
+// mailtoEscape percent-encodes a mailto component, using %20 for spaces
+func mailtoEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// escapeText escapes a vCard/iCalendar TEXT value
+func escapeText(s string) string {
+	s = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(s)
+	s = backslashEscape(s, `\;,`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+// backslashEscape prefixes each character of s found in special with a backslash
+func backslashEscape(s, special string) string {
+	var b strings.Builder
+	for _, char := range s {
+		if strings.ContainsRune(special, char) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(char)
+	}
+	return b.String()
+}
+
+// stripLineBreaks replaces line breaks with spaces in single-line values
+func stripLineBreaks(s string) string {
+	return strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(s)
+}
+
+// joinContentLines joins vCard/iCalendar content lines with CRLF, folding
+// any line longer than 75 octets without splitting a UTF-8 sequence
+func joinContentLines(lines []string) string {
+	var b strings.Builder
+	for _, line := range lines {
+		width := 0
+		for _, char := range line {
+			size := len(string(char))
+			if width+size > 75 {
+				b.WriteString("\r\n ")
+				width = 1
+			}
+			b.WriteRune(char)
+			width += size
+		}
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
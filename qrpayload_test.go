@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain", "Team meeting", "Team meeting"},
+		{"special characters", `a\b;c,d`, `a\\b\;c\,d`},
+		{"lf", "line 1\nline 2", `line 1\nline 2`},
+		{"crlf", "line 1\r\nline 2", `line 1\nline 2`},
+		{"lone cr", "line 1\rline 2", `line 1\nline 2`},
+		{"cr before crlf", "a\r\r\nb", `a\n\nb`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := escapeText(tt.input); got != tt.want {
+				t.Errorf("escapeText(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
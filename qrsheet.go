@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// labelLayout describes a printable sheet of labels. All measurements are
+// in PDF points (1/72 inch), with margins measured from the top-left corner.
+type labelLayout struct {
+	PageWidth   float64
+	PageHeight  float64
+	Columns     int
+	Rows        int
+	LabelWidth  float64
+	LabelHeight float64
+	MarginTop   float64
+	MarginLeft  float64
+	PitchX      float64 // distance between the left edges of adjacent labels
+	PitchY      float64 // distance between the top edges of adjacent labels
+}
+
+const (
+	pointsPerInch = 72.0
+	pointsPerMM   = 72.0 / 25.4
+
+	maxSheetCodes = 500
+)
+
+// labelLayouts holds the built-in sheet presets selectable with ?layout=
+var labelLayouts = map[string]labelLayout{
+	// Avery 5160 / 8160: 30 address labels, 2.625" x 1", US Letter
+	"avery-5160": {
+		PageWidth: 8.5 * pointsPerInch, PageHeight: 11 * pointsPerInch,
+		Columns: 3, Rows: 10,
+		LabelWidth: 2.625 * pointsPerInch, LabelHeight: 1 * pointsPerInch,
+		MarginTop: 0.5 * pointsPerInch, MarginLeft: 0.1875 * pointsPerInch,
+		PitchX: 2.75 * pointsPerInch, PitchY: 1 * pointsPerInch,
+	},
+	// Avery 5163 / 8163: 10 shipping labels, 4" x 2", US Letter
+	"avery-5163": {
+		PageWidth: 8.5 * pointsPerInch, PageHeight: 11 * pointsPerInch,
+		Columns: 2, Rows: 5,
+		LabelWidth: 4 * pointsPerInch, LabelHeight: 2 * pointsPerInch,
+		MarginTop: 0.5 * pointsPerInch, MarginLeft: 0.15625 * pointsPerInch,
+		PitchX: 4.1875 * pointsPerInch, PitchY: 2 * pointsPerInch,
+	},
+	// Avery L7160: 21 labels, 63.5mm x 38.1mm, A4
+	"avery-l7160": {
+		PageWidth: 210 * pointsPerMM, PageHeight: 297 * pointsPerMM,
+		Columns: 3, Rows: 7,
+		LabelWidth: 63.5 * pointsPerMM, LabelHeight: 38.1 * pointsPerMM,
+		MarginTop: 15.15 * pointsPerMM, MarginLeft: 7.25 * pointsPerMM,
+		PitchX: 66.04 * pointsPerMM, PitchY: 38.1 * pointsPerMM,
+	},
+}
+
+// handleQRSheet handles GET requests to render a PDF sheet of QR code labels
+//
+// Query parameters:
+//
+//	codes   comma-separated short codes (may be repeated)
+//	layout  preset name from labelLayouts (default avery-5160)
+//	skip    number of labels to leave blank at the start of the first page
+//	cols, rows, label_width, label_height, margin_top, margin_left,
+//	pitch_x, pitch_y, page_width, page_height
+//	        override individual layout values (points)
+func handleQRSheet(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET requests are supported")
+		return
+	}
+
+	if rejectBlockedClient(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+
+	var requested []string
+	for _, value := range query["codes"] {
+		for _, code := range strings.Split(value, ",") {
+			if code = strings.TrimSpace(code); code != "" {
+				requested = append(requested, code)
+			}
+		}
+	}
+	if len(requested) == 0 {
+		sendErrorResponse(w, http.StatusBadRequest, "Missing codes", "Provide one or more short codes with the 'codes' parameter")
+		return
+	}
+	if len(requested) > maxSheetCodes {
+		sendErrorResponse(w, http.StatusBadRequest, "Too many codes", fmt.Sprintf("A sheet may contain at most %d codes", maxSheetCodes))
+		return
+	}
+
+	layoutName := query.Get("layout")
+	if layoutName == "" {
+		layoutName = "avery-5160"
+	}
+	layout, ok := labelLayouts[strings.ToLower(layoutName)]
+	if !ok {
+		sendErrorResponse(w, http.StatusBadRequest, "Unknown layout", "Supported layouts: "+strings.Join(labelLayoutNames(), ", "))
+		return
+	}
+
+	layout, err := applyLayoutOverrides(layout, query)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid layout", err.Error())
+		return
+	}
+
+	skip := 0
+	if value := query.Get("skip"); value != "" {
+		skip, err = strconv.Atoi(value)
+		if err != nil || skip < 0 || skip >= layout.Columns*layout.Rows {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid skip", "skip must be between 0 and the number of labels per page minus one")
+			return
+		}
+	}
+
+	// Every code must exist before we render anything
+	shortURLs := make([]string, len(requested))
+	for i, code := range requested {
+		key, _, exists := lookupCode(code)
+		info, _ := linkDetails(key)
+		// Signed links cannot be printed without a signature
+		if !isValidShortCode(code) || !exists || info.Signed {
+			if !recordMiss(r) {
+				return
+			}
+			sendErrorResponse(w, http.StatusNotFound, "Code not found", fmt.Sprintf("Short code '%s' does not exist", code))
+			return
+		}
+		shortURLs[i] = fmt.Sprintf("%s/%s", baseURL, key)
+	}
+
+	pdf, err := renderQRSheet(layout, shortURLs, skip)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Generation failed", "Failed to generate QR sheet")
+		log.Printf("QR sheet generation failed: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="qr-labels.pdf"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(pdf)))
+	w.Write(pdf)
+	log.Printf("QR sheet generated: %d codes, layout %s", len(requested), layoutName)
+}
+
+// labelLayoutNames returns the preset names in a stable order
+func labelLayoutNames() []string {
+	names := make([]string, 0, len(labelLayouts))
+	for name := range labelLayouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyLayoutOverrides replaces layout values with any provided in the query
+func applyLayoutOverrides(layout labelLayout, query map[string][]string) (labelLayout, error) {
+	floats := map[string]*float64{
+		"label_width":  &layout.LabelWidth,
+		"label_height": &layout.LabelHeight,
+		"margin_top":   &layout.MarginTop,
+		"margin_left":  &layout.MarginLeft,
+		"pitch_x":      &layout.PitchX,
+		"pitch_y":      &layout.PitchY,
+		"page_width":   &layout.PageWidth,
+		"page_height":  &layout.PageHeight,
+	}
+	for name, field := range floats {
+		values := query[name]
+		if len(values) == 0 || values[0] == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(values[0], 64)
+		if err != nil || value < 0 || value > 5000 || math.IsNaN(value) {
+			return layout, fmt.Errorf("%s must be a number of points between 0 and 5000", name)
+		}
+		*field = value
+	}
+
+	ints := map[string]*int{
+		"cols": &layout.Columns,
+		"rows": &layout.Rows,
+	}
+	for name, field := range ints {
+		values := query[name]
+		if len(values) == 0 || values[0] == "" {
+			continue
+		}
+		value, err := strconv.Atoi(values[0])
+		if err != nil || value < 1 || value > 50 {
+			return layout, fmt.Errorf("%s must be between 1 and 50", name)
+		}
+		*field = value
+	}
+
+	if layout.LabelWidth < 18 || layout.LabelHeight < 18 {
+		return layout, fmt.Errorf("labels must be at least 18 points in each dimension")
+	}
+	if layout.MarginLeft+float64(layout.Columns-1)*layout.PitchX+layout.LabelWidth > layout.PageWidth ||
+		layout.MarginTop+float64(layout.Rows-1)*layout.PitchY+layout.LabelHeight > layout.PageHeight {
+		return layout, fmt.Errorf("the label grid does not fit on the page")
+	}
+
+	return layout, nil
+}
+
+// renderQRSheet lays out one QR label per short URL and returns the PDF bytes
+func renderQRSheet(layout labelLayout, shortURLs []string, skip int) ([]byte, error) {
+	perPage := layout.Columns * layout.Rows
+	doc := newPDFDocument(layout.PageWidth, layout.PageHeight)
+
+	var page *bytes.Buffer
+	for i, shortURL := range shortURLs {
+		slot := (i + skip) % perPage
+		if page == nil || slot == 0 {
+			page = doc.addPage()
+		}
+
+		col := slot % layout.Columns
+		row := slot / layout.Columns
+		left := layout.MarginLeft + float64(col)*layout.PitchX
+		top := layout.PageHeight - layout.MarginTop - float64(row)*layout.PitchY
+
+		if err := drawQRLabel(page, shortURL, left, top, layout.LabelWidth, layout.LabelHeight); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc.bytes(), nil
+}
+
+// drawQRLabel draws a QR code with its URL printed underneath, centered in
+// the label whose top-left corner is at (left, top)
+func drawQRLabel(page *bytes.Buffer, shortURL string, left, top, width, height float64) error {
+	qr, err := qrcode.New(shortURL, qrcode.Medium)
+	if err != nil {
+		return err
+	}
+	qr.DisableBorder = true
+	bitmap := qr.Bitmap()
+
+	const padding = 4.0
+
+	// Courier glyphs are 0.6em wide, which lets us size the caption exactly
+	textSize := math.Min(8, (width-2*padding)/(0.6*float64(len(shortURL))))
+	textSize = math.Max(textSize, 3)
+
+	side := math.Min(width-2*padding, height-2*padding-textSize-2)
+	module := side / float64(len(bitmap))
+
+	qrLeft := left + (width-side)/2
+	qrTop := top - padding
+
+	// Merge horizontal runs of dark modules into single rectangles
+	fmt.Fprintf(page, "0 g\n")
+	for y, row := range bitmap {
+		for x := 0; x < len(row); {
+			if !row[x] {
+				x++
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(page, "%.3f %.3f %.3f %.3f re\n",
+				qrLeft+float64(start)*module, qrTop-float64(y+1)*module,
+				float64(x-start)*module, module)
+		}
+	}
+	fmt.Fprintf(page, "f\n")
+
+	textWidth := 0.6 * textSize * float64(len(shortURL))
+	textLeft := left + (width-textWidth)/2
+	baseline := qrTop - side - 1 - textSize*0.8
+	fmt.Fprintf(page, "BT /F1 %.2f Tf %.3f %.3f Td (%s) Tj ET\n", textSize, textLeft, baseline, pdfEscape(shortURL))
+
+	return nil
+}
+
+// pdfDocument is a minimal PDF 1.4 writer supporting vector pages and a
+// single built-in font, which is all the label sheets need
+type pdfDocument struct {
+	width  float64
+	height float64
+	pages  []*bytes.Buffer
+}
+
+func newPDFDocument(width, height float64) *pdfDocument {
+	return &pdfDocument{width: width, height: height}
+}
+
+// addPage starts a new page and returns its content stream
+func (d *pdfDocument) addPage() *bytes.Buffer {
+	page := &bytes.Buffer{}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+// bytes serializes the document. Objects are numbered as follows:
+// 1 catalog, 2 page tree, 3 font, then a page object and its content
+// stream for every page.
+func (d *pdfDocument) bytes() []byte {
+	var out bytes.Buffer
+	offsets := []int{0}
+
+	writeObject := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets)-1, body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+
+	writeObject("<< /Type /Catalog /Pages 2 0 R >>")
+	writeObject(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	writeObject("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range d.pages {
+		writeObject(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			d.width, d.height, 5+2*i))
+		writeObject(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets))
+	for _, offset := range offsets[1:] {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets), xref)
+
+	return out.Bytes()
+}
+
+// pdfEscape escapes a string for use inside a PDF literal string
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, char := range s {
+		switch {
+		case char == '(' || char == ')' || char == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(char)
+		case char < 0x20 || char > 0x7e:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(char)
+		}
+	}
+	return b.String()
+}
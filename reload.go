@@ -0,0 +1,34 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// reloadHooks are run whenever the process receives SIGHUP
+var reloadHooks []func() error
+
+// onReload registers a function to run on SIGHUP
+func onReload(hook func() error) {
+	reloadHooks = append(reloadHooks, hook)
+}
+
+// watchReloadSignal runs the reload hooks each time SIGHUP is received,
+// keeping the previous configuration if a hook fails
+func watchReloadSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		for range signals {
+			log.Printf("Received SIGHUP, reloading configuration")
+			for _, hook := range reloadHooks {
+				if err := hook(); err != nil {
+					log.Printf("Reload failed: %v", err)
+				}
+			}
+		}
+	}()
+}
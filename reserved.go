@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// defaultReservedCodes is used when RESERVED_CODES_FILE is not set
+var defaultReservedCodes = []string{
+	"admin", "api", "www", "ftp", "mail", "email", "support", "help",
+	"about", "contact", "terms", "privacy", "legal", "blog", "news",
+	"docs", "documentation", "download", "downloads", "upload", "uploads",
+	"static", "assets", "css", "js", "img", "images", "favicon",
+	"robots", "sitemap", "feed", "rss", "atom", "xml", "json",
+	"login", "logout", "signin", "signup", "register", "auth",
+	"dashboard", "profile", "account", "settings", "config",
+	"test", "testing", "dev", "development", "staging", "prod", "production",
+	"qr", "shorten", "short", "url", "link", "redirect",
+}
+
+// reservedList holds the reserved code patterns. Patterns are lowercase
+// globs, so "admin*" reserves every code starting with "admin".
+type reservedList struct {
+	path     string // file the patterns were loaded from, if any
+	patterns []string
+	routes   []string // first path segment of every registered route
+	mu       sync.RWMutex
+}
+
+// ReservedResponse represents the JSON response of the reserved list endpoint
+type ReservedResponse struct {
+	Source   string   `json:"source"`
+	Patterns []string `json:"patterns"`
+	Routes   []string `json:"routes"`
+}
+
+var reserved = &reservedList{patterns: defaultReservedCodes}
+
+// handleRoute registers a handler and reserves the first segment of its
+// path so that no short code can shadow it
+func handleRoute(pattern string, handler http.HandlerFunc) {
+	http.HandleFunc(pattern, handler)
+
+	segment := strings.ToLower(strings.SplitN(strings.TrimPrefix(pattern, "/"), "/", 2)[0])
+	if segment == "" {
+		return
+	}
+
+	reserved.mu.Lock()
+	defer reserved.mu.Unlock()
+	for _, route := range reserved.routes {
+		if route == segment {
+			return
+		}
+	}
+	reserved.routes = append(reserved.routes, segment)
+}
+
+// loadReservedCodes reads RESERVED_CODES_FILE, keeping the built-in list
+// when it is not set
+func loadReservedCodes() error {
+	reserved.mu.Lock()
+	reserved.path = os.Getenv("RESERVED_CODES_FILE")
+	reserved.mu.Unlock()
+
+	return reserved.reload()
+}
+
+// reload re-reads the patterns from the configured file
+func (l *reservedList) reload() error {
+	l.mu.RLock()
+	filename := l.path
+	l.mu.RUnlock()
+
+	if filename == "" {
+		return nil
+	}
+
+	patterns, err := readPatternFile(filename)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.patterns = patterns
+	l.mu.Unlock()
+
+	log.Printf("Loaded %d reserved code patterns from %s", len(patterns), filename)
+	return nil
+}
+
+// readPatternFile reads one lowercase pattern per line, skipping blank
+// lines and # comments
+func readPatternFile(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := path.Match(line, ""); err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern %q", filename, line)
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return patterns, nil
+}
+
+// matches reports whether code is reserved by a pattern or a route
+func (l *reservedList) matches(code string) bool {
+	lowerCode := strings.ToLower(code)
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, route := range l.routes {
+		if lowerCode == route {
+			return true
+		}
+	}
+	for _, pattern := range l.patterns {
+		if matched, _ := path.Match(pattern, lowerCode); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshot returns the effective reserved list
+func (l *reservedList) snapshot() ReservedResponse {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	response := ReservedResponse{
+		Source:   l.path,
+		Patterns: append([]string(nil), l.patterns...),
+		Routes:   append([]string(nil), l.routes...),
+	}
+	if response.Source == "" {
+		response.Source = "built-in"
+	}
+	sort.Strings(response.Routes)
+	return response
+}
+
+// handleReserved handles requests for the effective reserved code list.
+// GET returns it; POST reloads the file first.
+func handleReserved(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := reserved.reload(); err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, "Reload failed", err.Error())
+			return
+		}
+	default:
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET and POST requests are supported")
+		return
+	}
+
+	sendJSONResponse(w, http.StatusOK, reserved.snapshot())
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const defaultMaxChainDepth = 5
+
+// Self-link policies: what to do when a destination is one of our own URLs
+const (
+	selfLinkReject  = "reject"
+	selfLinkResolve = "resolve"
+)
+
+// selfLinkConfig describes which hosts are our own and how links to them
+// are handled
+type selfLinkConfig struct {
+	Hosts    map[string]bool // lowercase host names, without ports
+	Policy   string
+	MaxDepth int
+}
+
+var selfLinks = selfLinkConfig{Hosts: map[string]bool{}, Policy: selfLinkReject, MaxDepth: defaultMaxChainDepth}
+
+// loadSelfLinkConfig builds the set of our own hosts from BASE_URL and
+// ALIAS_DOMAINS and reads SELF_LINK_POLICY and MAX_CHAIN_DEPTH
+func loadSelfLinkConfig() (selfLinkConfig, error) {
+	cfg := selfLinkConfig{Hosts: map[string]bool{}, Policy: selfLinkReject, MaxDepth: defaultMaxChainDepth}
+
+	if u, err := url.Parse(baseURL); err == nil && u.Hostname() != "" {
+		cfg.Hosts[strings.ToLower(u.Hostname())] = true
+	}
+	for _, alias := range strings.Split(os.Getenv("ALIAS_DOMAINS"), ",") {
+		alias = strings.ToLower(strings.TrimSpace(alias))
+		if alias == "" {
+			continue
+		}
+		host, err := canonicalHost(alias)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid ALIAS_DOMAINS entry %q", alias)
+		}
+		cfg.Hosts[host] = true
+	}
+
+	if policy := os.Getenv("SELF_LINK_POLICY"); policy != "" {
+		if policy != selfLinkReject && policy != selfLinkResolve {
+			return cfg, fmt.Errorf("invalid SELF_LINK_POLICY %q: must be %q or %q", policy, selfLinkReject, selfLinkResolve)
+		}
+		cfg.Policy = policy
+	}
+
+	if value := os.Getenv("MAX_CHAIN_DEPTH"); value != "" {
+		depth, err := strconv.Atoi(value)
+		if err != nil || depth < 1 {
+			return cfg, fmt.Errorf("invalid MAX_CHAIN_DEPTH %q: must be a positive number", value)
+		}
+		cfg.MaxDepth = depth
+	}
+
+	return cfg, nil
+}
+
+// isOwnHost reports whether a destination URL points at this service
+func (c selfLinkConfig) isOwnHost(rawURL string) bool {
+	host := hostOf(rawURL)
+	return host != "" && c.Hosts[host]
+}
+
+// unknownSelfLink is the one answer for our URLs that cannot be followed,
+// so /shorten does not tell missing codes apart from protected ones
+const unknownSelfLink = "URL points to a short link that does not exist"
+
+// resolve follows a destination through our own short links to its final
+// target. It returns the destination unchanged if it is not one of our
+// URLs, or the reason it cannot be shortened. unknown is set when the
+// reason is unknownSelfLink, which callers count like a 404.
+func (c selfLinkConfig) resolve(rawURL string) (destination, reason string, unknown bool) {
+	destination = rawURL
+	visited := make(map[string]bool)
+
+	for depth := 0; c.isOwnHost(destination); depth++ {
+		if c.Policy == selfLinkReject {
+			return "", "URL must not point to this URL shortener", false
+		}
+		if depth >= c.MaxDepth {
+			return "", fmt.Sprintf("URL redirects through more than %d short links", c.MaxDepth), false
+		}
+
+		u, _ := url.Parse(destination)
+		code := strings.TrimPrefix(u.Path, "/")
+		if code == "" || strings.Contains(code, "/") {
+			return "", "URL points to this URL shortener but not to a short link", false
+		}
+
+		// Password-protected and signed links must not leak their
+		// destination through a new public code
+		key, target, exists := lookupCode(code)
+		if !exists {
+			return "", unknownSelfLink, true
+		}
+		if info, _ := linkDetails(key); info.PasswordHash != "" || info.Signed {
+			return "", unknownSelfLink, true
+		}
+		if visited[key] {
+			return "", "URL is part of a redirect loop", false
+		}
+		visited[key] = true
+		destination = target
+	}
+
+	return destination, "", false
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math/bits"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSequenceFile  = "sequence.dat"
+	defaultSequenceBlock = 1000
+	feistelRounds        = 8
+
+	sequenceLockTimeout = 5 * time.Second
+	sequenceLockStale   = 30 * time.Second
+)
+
+// sequenceGenerator hands out collision-free codes by encoding increasing
+// IDs through a keyed permutation. IDs are leased from a counter file in
+// blocks so several replicas can share one file without reusing IDs.
+type sequenceGenerator struct {
+	path      string
+	blockSize uint64
+	key       []byte
+	next      uint64 // next unused ID in the current lease
+	end       uint64 // first ID past the current lease
+	mu        sync.Mutex
+}
+
+// sequence is nil unless CODE_GENERATOR=sequential
+var sequence *sequenceGenerator
+
+// loadSequenceGenerator reads CODE_GENERATOR and, in sequential mode,
+// CODE_SECRET, CODE_SEQUENCE_FILE and CODE_SEQUENCE_BLOCK
+func loadSequenceGenerator() (*sequenceGenerator, error) {
+	switch strings.ToLower(os.Getenv("CODE_GENERATOR")) {
+	case "", "random":
+		return nil, nil
+	case "sequential":
+	default:
+		return nil, fmt.Errorf("invalid CODE_GENERATOR %q: must be random or sequential", os.Getenv("CODE_GENERATOR"))
+	}
+
+	secret := os.Getenv("CODE_SECRET")
+	if len(secret) < 16 {
+		return nil, fmt.Errorf("CODE_SECRET of at least 16 characters is required for sequential codes")
+	}
+
+	path := os.Getenv("CODE_SEQUENCE_FILE")
+	if path == "" {
+		path = defaultSequenceFile
+	}
+
+	blockSize := uint64(defaultSequenceBlock)
+	if value := os.Getenv("CODE_SEQUENCE_BLOCK"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || parsed == 0 {
+			return nil, fmt.Errorf("invalid CODE_SEQUENCE_BLOCK %q", value)
+		}
+		blockSize = parsed
+	}
+
+	if _, ok := domainSize(codes.Length); !ok {
+		return nil, fmt.Errorf("CODE_LENGTH %d is too long for sequential codes with a %d character alphabet", codes.Length, len(codes.Alphabet))
+	}
+
+	return &sequenceGenerator{path: path, blockSize: blockSize, key: []byte(secret)}, nil
+}
+
+// nextCode returns the code for the next unused ID
+func (g *sequenceGenerator) nextCode() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for {
+		if g.next == g.end {
+			start, err := g.lease()
+			if err != nil {
+				return "", err
+			}
+			g.next, g.end = start, start+g.blockSize
+		}
+
+		id := g.next
+		g.next++
+
+		code, err := g.encode(id)
+		if err != nil {
+			return "", err
+		}
+
+		// Skip IDs whose code is offensive, reserved or taken by a custom code
+		if profanity.contains(code) || isReservedCode(code) {
+			continue
+		}
+
+		if _, _, exists := lookupCode(code); !exists {
+			return code, nil
+		}
+	}
+}
+
+// lease reserves the next block of IDs from the counter file
+func (g *sequenceGenerator) lease() (uint64, error) {
+	unlock, err := lockFile(g.path + ".lock")
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	var start uint64
+	data, err := os.ReadFile(g.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return 0, err
+	default:
+		if start, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err != nil {
+			return 0, fmt.Errorf("corrupt sequence file %s: %w", g.path, err)
+		}
+	}
+
+	// Write the new high-water mark atomically before handing out the block
+	tmp := g.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(start+g.blockSize, 10)+"\n"), 0o644); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, g.path); err != nil {
+		return 0, err
+	}
+
+	log.Printf("Leased short code IDs %d-%d", start, start+g.blockSize-1)
+	return start, nil
+}
+
+// lockFile takes an exclusive lock by creating path, breaking locks left
+// behind by crashed processes. The returned function releases the lock.
+func lockFile(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(sequenceLockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		if info, statErr := os.Stat(path); statErr == nil && time.Since(info.ModTime()) > sequenceLockStale {
+			log.Printf("Removing stale lock %s", path)
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// encode maps an ID to its code. IDs fill the codes of the configured length
+// first, then each longer length in turn.
+func (g *sequenceGenerator) encode(id uint64) (string, error) {
+	length := codes.Length
+	for {
+		size, ok := domainSize(length)
+		if !ok || length > codes.maxLength() {
+			return "", fmt.Errorf("ID %d is beyond the sequential code space", id)
+		}
+		if id < size {
+			return formatCode(g.permute(id, length, size), length), nil
+		}
+		id -= size
+		length++
+	}
+}
+
+// decode maps a code produced by encode back to its ID
+func (g *sequenceGenerator) decode(code string) (uint64, error) {
+	length := len(code)
+	if length < codes.Length {
+		return 0, fmt.Errorf("code is shorter than generated codes")
+	}
+
+	size, ok := domainSize(length)
+	if !ok {
+		return 0, fmt.Errorf("code is beyond the sequential code space")
+	}
+
+	var index uint64
+	for i := 0; i < len(code); i++ {
+		digit := strings.IndexByte(codes.Alphabet, code[i])
+		if digit < 0 {
+			return 0, fmt.Errorf("code contains characters outside the alphabet")
+		}
+		index = index*uint64(len(codes.Alphabet)) + uint64(digit)
+	}
+	if index >= size {
+		return 0, fmt.Errorf("code is beyond the sequential code space")
+	}
+
+	id := g.unpermute(index, length, size)
+	for l := codes.Length; l < length; l++ {
+		previous, _ := domainSize(l)
+		id += previous
+	}
+	return id, nil
+}
+
+// domainSize returns the number of codes of length, reporting false when it
+// does not fit the 62-bit domain of the permutation
+func domainSize(length int) (uint64, bool) {
+	size := uint64(1)
+	for i := 0; i < length; i++ {
+		hi, lo := bits.Mul64(size, uint64(len(codes.Alphabet)))
+		if hi != 0 || lo > 1<<62 {
+			return 0, false
+		}
+		size = lo
+	}
+	return size, true
+}
+
+// formatCode writes index in the code alphabet, zero-padded to length
+func formatCode(index uint64, length int) string {
+	base := uint64(len(codes.Alphabet))
+	code := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		code[i] = codes.Alphabet[index%base]
+		index /= base
+	}
+	return string(code)
+}
+
+// permute applies a keyed Feistel network to x, cycle-walking until the
+// result falls back inside [0, size)
+func (g *sequenceGenerator) permute(x uint64, length int, size uint64) uint64 {
+	half, mask := feistelHalf(size)
+	for {
+		left, right := x>>half, x&mask
+		for round := 0; round < feistelRounds; round++ {
+			left, right = right, left^(g.feistelRound(round, length, right)&mask)
+		}
+		x = left<<half | right
+		if x < size {
+			return x
+		}
+	}
+}
+
+// unpermute inverts permute
+func (g *sequenceGenerator) unpermute(x uint64, length int, size uint64) uint64 {
+	half, mask := feistelHalf(size)
+	for {
+		left, right := x>>half, x&mask
+		for round := feistelRounds - 1; round >= 0; round-- {
+			left, right = right^(g.feistelRound(round, length, left)&mask), left
+		}
+		x = left<<half | right
+		if x < size {
+			return x
+		}
+	}
+}
+
+// feistelHalf returns the width and mask of each half of a Feistel block
+// large enough to hold size values
+func feistelHalf(size uint64) (uint, uint64) {
+	width := uint(bits.Len64(size - 1))
+	if width < 2 {
+		width = 2
+	}
+	half := (width + 1) / 2
+	return half, 1<<half - 1
+}
+
+// feistelRound is the keyed round function of the permutation
+func (g *sequenceGenerator) feistelRound(round, length int, value uint64) uint64 {
+	var input [17]byte
+	input[0] = byte(round)
+	binary.BigEndian.PutUint64(input[1:], uint64(length))
+	binary.BigEndian.PutUint64(input[9:], value)
+
+	mac := hmac.New(sha256.New, g.key)
+	mac.Write(input[:])
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
+
+// CodeInfoResponse represents the JSON response of the admin code lookup
+type CodeInfoResponse struct {
+	Code        string `json:"code"`
+	ID          uint64 `json:"id"`
+	OriginalURL string `json:"original_url,omitempty"`
+}
+
+// handleAdminCode handles GET /api/admin/codes/{code}, decoding a
+// sequential code back to the ID it was allocated from
+func handleAdminCode(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET requests are supported")
+		return
+	}
+	if sequence == nil {
+		sendErrorResponse(w, http.StatusNotFound, "Not available", "Codes can only be decoded with CODE_GENERATOR=sequential")
+		return
+	}
+
+	shortCode := strings.TrimPrefix(r.URL.Path, "/api/admin/codes/")
+	id, err := sequence.decode(shortCode)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid code", err.Error())
+		return
+	}
+
+	_, originalURL, _ := lookupCode(shortCode)
+
+	sendJSONResponse(w, http.StatusOK, CodeInfoResponse{Code: shortCode, ID: id, OriginalURL: originalURL})
+}
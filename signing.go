@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSignedLinkTTL = 7 * 24 * time.Hour
+	maxSignedLinkTTL     = 365 * 24 * time.Hour
+	signatureSize        = 16 // bytes of the HMAC kept in the URL
+)
+
+// signingKey is one of the secrets signed links can be verified with
+type signingKey struct {
+	ID     string
+	Secret []byte
+}
+
+var (
+	// signingKeys are tried in order when verifying; the first one signs
+	// new URLs. Keeping an old key listed after a new one lets URLs signed
+	// with it work until they expire.
+	signingKeys []signingKey
+
+	signedLinkTTL = defaultSignedLinkTTL
+)
+
+// SignLinkRequest represents the JSON request for minting a signed URL
+type SignLinkRequest struct {
+	ExpiresIn int64 `json:"expires_in,omitempty"` // seconds, defaults to SIGNED_LINK_TTL
+}
+
+// SignedLinkResponse represents the JSON response for a minted signed URL
+type SignedLinkResponse struct {
+	SignedURL string    `json:"signed_url"`
+	KeyID     string    `json:"kid"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// loadSigningKeys reads SIGNING_KEYS ("kid:secret,kid:secret") and
+// SIGNED_LINK_TTL from the environment
+func loadSigningKeys() error {
+	for _, entry := range strings.Split(os.Getenv("SIGNING_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, secret, found := strings.Cut(entry, ":")
+		if !found || id == "" || strings.ContainsAny(id, "&=?#/ ") {
+			return fmt.Errorf("invalid SIGNING_KEYS entry: expected kid:secret")
+		}
+		if len(secret) < 16 {
+			return fmt.Errorf("SIGNING_KEYS secret for %q must be at least 16 characters", id)
+		}
+		for _, key := range signingKeys {
+			if key.ID == id {
+				return fmt.Errorf("duplicate SIGNING_KEYS key id %q", id)
+			}
+		}
+		signingKeys = append(signingKeys, signingKey{ID: id, Secret: []byte(secret)})
+	}
+
+	if value := os.Getenv("SIGNED_LINK_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 || ttl > maxSignedLinkTTL {
+			return fmt.Errorf("invalid SIGNED_LINK_TTL %q: must be a duration up to %s", value, maxSignedLinkTTL)
+		}
+		signedLinkTTL = ttl
+	}
+	return nil
+}
+
+// signedLinkExpiry turns a requested lifetime in seconds into an expiry
+// time, using the default for 0
+func signedLinkExpiry(expiresIn int64) (time.Time, error) {
+	ttl := signedLinkTTL
+	if expiresIn != 0 {
+		if expiresIn < 0 || expiresIn > int64(maxSignedLinkTTL/time.Second) {
+			return time.Time{}, fmt.Errorf("expires_in must be between 1 and %d seconds", int64(maxSignedLinkTTL/time.Second))
+		}
+		ttl = time.Duration(expiresIn) * time.Second
+	}
+	return time.Now().Add(ttl).Truncate(time.Second), nil
+}
+
+// signLink returns the short URL of code signed with the primary key
+func signLink(code string, expires time.Time) string {
+	key := signingKeys[0]
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return fmt.Sprintf("%s/%s?exp=%s&kid=%s&sig=%s", baseURL, url.PathEscape(code), exp, key.ID, linkSignature(key, code, exp))
+}
+
+func linkSignature(key signingKey, code, exp string) string {
+	mac := hmac.New(sha256.New, key.Secret)
+	mac.Write([]byte(code + "\x00" + exp))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:signatureSize])
+}
+
+// signatureParams returns the signature parameters of a request, to be
+// carried over to links the response points back at
+func signatureParams(r *http.Request) url.Values {
+	params := url.Values{}
+	query := r.URL.Query()
+	for _, name := range []string{"exp", "kid", "sig"} {
+		if value := query.Get(name); value != "" {
+			params.Set(name, value)
+		}
+	}
+	return params
+}
+
+// hasValidSignature reports whether a request for code carries an
+// unexpired signature made with one of the active keys
+func hasValidSignature(r *http.Request, code string) bool {
+	query := r.URL.Query()
+	exp, kid, sig := query.Get("exp"), query.Get("kid"), query.Get("sig")
+	if exp == "" || sig == "" {
+		return false
+	}
+
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return false
+	}
+
+	for _, key := range signingKeys {
+		if kid != "" && key.ID != kid {
+			continue
+		}
+		if hmac.Equal([]byte(sig), []byte(linkSignature(key, code, exp))) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHiddenLink reports whether a link requires a signature the request
+// does not have, in which case it must look like it does not exist
+func isHiddenLink(r *http.Request, code string, info linkInfo) bool {
+	return info.Signed && !hasValidSignature(r, code)
+}
+
+// handleLinks handles POST /api/links/{code}/sign, which mints a signed URL
+// for a signed link. An admin may call it, or the owner of a link created
+// with an X-API-Key, sending the same key. Client addresses are shared
+// behind NATs and proxies, so they never prove ownership here.
+func handleLinks(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/links/")
+	shortCode, action, found := strings.Cut(path, "/")
+	if !found || action != "sign" || shortCode == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "Only POST requests are supported")
+		return
+	}
+
+	if len(signingKeys) == 0 {
+		sendErrorResponse(w, http.StatusNotFound, "Not available", "Signed links are not enabled")
+		return
+	}
+
+	// An Authorization header means the caller acts as admin
+	admin := r.Header.Get("Authorization") != ""
+	if admin && !requireAdmin(w, r) {
+		return
+	}
+	if !admin && r.Header.Get("X-API-Key") == "" {
+		sendErrorResponse(w, http.StatusUnauthorized, "Unauthorized", "Send the X-API-Key the link was created with")
+		return
+	}
+
+	// Clients probing for codes are turned away until their block ends
+	if rejectBlockedClient(w, r) {
+		return
+	}
+
+	key, _, exists := lookupCode(shortCode)
+	info, _ := linkDetails(key)
+	if !exists || (!admin && info.Owner != callerID(r)) {
+		if !recordMiss(r) {
+			return
+		}
+		sendErrorResponse(w, http.StatusNotFound, "Code not found", fmt.Sprintf("Short code '%s' does not exist", shortCode))
+		return
+	}
+	if !info.Signed {
+		sendErrorResponse(w, http.StatusBadRequest, "Not a signed link", "Only links created with signed set can be signed")
+		return
+	}
+
+	var req SignLinkRequest
+	if r.ContentLength != 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, 4096)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON", "Request body must be valid JSON")
+			return
+		}
+	}
+
+	expires, err := signedLinkExpiry(req.ExpiresIn)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid expiry", err.Error())
+		return
+	}
+
+	sendJSONResponse(w, http.StatusOK, SignedLinkResponse{
+		SignedURL: signLink(key, expires),
+		KeyID:     signingKeys[0].ID,
+		ExpiresAt: expires.UTC(),
+	})
+	log.Printf("Signed URL minted for: %s (expires %s)", key, expires.UTC().Format(time.RFC3339))
+}
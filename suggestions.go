@@ -0,0 +1,183 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const maxSuggestions = 5
+
+// codeSynonyms offers alternative words for common parts of custom codes
+var codeSynonyms = map[string][]string{
+	"app":     {"tool", "apps"},
+	"blog":    {"posts", "journal"},
+	"docs":    {"guide", "manual"},
+	"event":   {"meetup", "events"},
+	"home":    {"start", "main"},
+	"info":    {"details", "facts"},
+	"jobs":    {"careers", "hiring"},
+	"launch":  {"release", "debut"},
+	"meeting": {"sync", "call"},
+	"news":    {"updates", "bulletin"},
+	"party":   {"bash", "social"},
+	"photo":   {"pic", "snap"},
+	"promo":   {"offer", "deal"},
+	"report":  {"summary", "review"},
+	"sale":    {"deal", "offer"},
+	"shop":    {"store", "market"},
+	"signup":  {"join", "enroll"},
+	"team":    {"crew", "squad"},
+	"video":   {"clip", "watch"},
+}
+
+// codeProblem describes why a custom code cannot be used
+type codeProblem struct {
+	Status  int
+	Error   string
+	Message string
+}
+
+// CodeAvailabilityResponse represents the JSON response of the
+// availability check endpoint
+type CodeAvailabilityResponse struct {
+	Code        string   `json:"code"`
+	Available   bool     `json:"available"`
+	Reason      string   `json:"reason,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// checkCustomCode returns the reason a custom code cannot be used, or nil
+// if it is free to take
+func checkCustomCode(code string) *codeProblem {
+	// Validate custom code
+	if !isValidCustomCode(code) {
+		return &codeProblem{http.StatusBadRequest, "Invalid custom code", "Custom code must be 3-20 characters, alphanumeric and hyphens only"}
+	}
+
+	// Check if custom code is reserved
+	if isReservedCode(code) {
+		return &codeProblem{http.StatusBadRequest, "Reserved code", "This custom code is reserved and cannot be used"}
+	}
+
+	// Check if custom code contains offensive words
+	if profanity.contains(code) {
+		return &codeProblem{http.StatusBadRequest, "Inappropriate code", "This custom code contains a word that is not allowed"}
+	}
+
+	// Check if custom code already exists, ignoring case if configured
+	if _, _, exists := lookupCode(code); exists {
+		return &codeProblem{http.StatusConflict, "Code already exists", "This custom code is already in use"}
+	}
+
+	return nil
+}
+
+// suggestCodes returns up to maxSuggestions alternatives to code, each
+// checked to be available at the time of the call
+func suggestCodes(code string) []string {
+	base := strings.ToLower(strings.Trim(code, "-"))
+	if base == "" {
+		return nil
+	}
+
+	// Appending "2" to "promo1" would give the confusing "promo12"
+	var candidates []string
+	if unicode.IsDigit(rune(base[len(base)-1])) {
+		candidates = append(candidates, base+"-2")
+	} else {
+		candidates = append(candidates, base+"2", base+"-2")
+	}
+
+	// Swap any word we know a synonym for
+	parts := strings.Split(hyphenateCode(base), "-")
+	for i, part := range parts {
+		for _, synonym := range codeSynonyms[part] {
+			variant := append([]string(nil), parts...)
+			variant[i] = synonym
+			candidates = append(candidates, strings.Join(variant, "-"))
+		}
+	}
+
+	// Hyphenated variants
+	if split := hyphenateCode(base); split != base {
+		candidates = append(candidates, split)
+	}
+	candidates = append(candidates, "get-"+base, "my-"+base, base+"-link")
+
+	// Fall back to numeric suffixes
+	for n := 3; n < 100; n++ {
+		candidates = append(candidates, base+"-"+strconv.Itoa(n))
+	}
+
+	seen := map[string]bool{code: true}
+	suggestions := []string{}
+	for _, candidate := range candidates {
+		if len(suggestions) == maxSuggestions {
+			break
+		}
+		if seen[candidate] {
+			continue
+		}
+		seen[candidate] = true
+
+		if checkCustomCode(candidate) == nil {
+			suggestions = append(suggestions, candidate)
+		}
+	}
+
+	return suggestions
+}
+
+// hyphenateCode inserts hyphens where letters meet digits, so "sale2025"
+// becomes "sale-2025"
+func hyphenateCode(code string) string {
+	var b strings.Builder
+	var last rune
+	for i, char := range code {
+		if i > 0 && last != '-' && char != '-' && unicode.IsDigit(char) != unicode.IsDigit(last) {
+			b.WriteByte('-')
+		}
+		b.WriteRune(char)
+		last = char
+	}
+	return b.String()
+}
+
+// handleCodes handles GET /api/codes/{code}/available, reporting whether a
+// custom code can be used and suggesting alternatives when it cannot
+func handleCodes(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/codes/")
+	shortCode, action, found := strings.Cut(path, "/")
+	if !found || action != "available" || shortCode == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET requests are supported")
+		return
+	}
+
+	if rejectBlockedClient(w, r) {
+		return
+	}
+
+	// An available code is one that does not exist, so it counts against
+	// the client like a 404 would
+	response := CodeAvailabilityResponse{Code: shortCode, Available: true}
+	if problem := checkCustomCode(shortCode); problem != nil {
+		response.Available = false
+		response.Reason = problem.Message
+		// Only codes that are merely taken have useful alternatives
+		if problem.Status == http.StatusConflict {
+			response.Suggestions = suggestCodes(shortCode)
+		}
+	} else if !recordMiss(r) {
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	sendJSONResponse(w, http.StatusOK, response)
+}
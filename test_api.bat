@@ -10,7 +10,7 @@ REM Check if server is running
 echo 📡 Checking if server is running...
 curl -s http://localhost:8080 >nul 2>&1
 if %errorlevel% neq 0 (
-    echo ❌ Server is not running. Please start it with: go run main.go
+    echo ❌ Server is not running. Please start it with: go run .
     pause
     exit /b 1
 )
@@ -10,7 +10,7 @@ echo ""
 # Check if server is running
 echo "📡 Checking if server is running..."
 if ! curl -s http://localhost:8080 > /dev/null; then
-    echo "❌ Server is not running. Please start it with: go run main.go"
+    echo "❌ Server is not running. Please start it with: go run ."
     exit 1
 fi
 echo "✅ Server is running!"
@@ -74,6 +74,45 @@ response=$(curl -s -I http://localhost:8080/nonexistent | head -n 1)
 echo "Response: $response"
 echo ""
 
+# Test 7: URL canonicalization
+echo "🧪 Test 7: Testing URL canonicalization"
+echo "Each URL is shortened and the stored original_url compared with the expected canonical form"
+failures=0
+while IFS='|' read -r input expected; do
+    response=$(curl -s -X POST http://localhost:8080/shorten \
+      -H "Content-Type: application/json" \
+      -d "{\"url\": \"$input\"}")
+    actual=$(echo "$response" | grep -o '"original_url":"[^"]*"' | cut -d'"' -f4)
+    if [ "$actual" = "$expected" ]; then
+        echo "  ✅ $input -> $actual"
+    else
+        echo "  ❌ $input -> $actual (expected $expected)"
+        failures=$((failures + 1))
+    fi
+done <<'CASES'
+HTTP://Example.COM/|http://example.com/
+http://example.com|http://example.com/
+http://example.com:80/a|http://example.com/a
+https://example.com:443/a|https://example.com/a
+https://example.com:8443/a|https://example.com:8443/a
+http://example.com/a/../b|http://example.com/b
+http://example.com/a/./b/.|http://example.com/a/b/
+http://example.com/../../a|http://example.com/a
+http://example.com/%7Euser/%41|http://example.com/~user/A
+http://example.com/a%2fb|http://example.com/a%2Fb
+https://bücher.de/|https://xn--bcher-kva.de/
+http://example.com/b?utm_source=x&utm_medium=y|http://example.com/b
+http://example.com/b?id=1&fbclid=abc&gclid=def|http://example.com/b?id=1
+http://example.com/b?a=1&|http://example.com/b?a=1
+http://Example.com:80/a/../b?utm_source=x|http://example.com/b
+http://example.com/b#section-2|http://example.com/b#section-2
+CASES
+echo ""
+if [ "$failures" -gt 0 ]; then
+    echo "❌ $failures canonicalization cases failed"
+    exit 1
+fi
+
 echo "✅ All tests completed!"
 echo ""
 echo "💡 To test the web interface, open: http://localhost:8080"
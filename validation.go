@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const defaultMaxURLLength = 2048
+
+// nonPublicTLDs are suffixes reserved for private networks, documentation
+// or testing, which no public destination can use
+var nonPublicTLDs = map[string]bool{
+	"arpa": true, "corp": true, "example": true, "home": true,
+	"internal": true, "intranet": true, "invalid": true, "lan": true,
+	"local": true, "localdomain": true, "localhost": true, "onion": true,
+	"private": true, "test": true,
+}
+
+// validationPolicy controls which destinations handleShorten accepts
+type validationPolicy struct {
+	MaxLength        int
+	AllowPrivate     bool // private, loopback and link-local IP literals
+	AllowCredentials bool // user:password@ in the URL
+	RequirePublicTLD bool
+}
+
+var urlPolicy = validationPolicy{MaxLength: defaultMaxURLLength, RequirePublicTLD: true}
+
+// loadValidationPolicy reads URL_MAX_LENGTH, URL_ALLOW_PRIVATE,
+// URL_ALLOW_CREDENTIALS and URL_REQUIRE_PUBLIC_TLD from the environment
+func loadValidationPolicy() (validationPolicy, error) {
+	policy := validationPolicy{MaxLength: defaultMaxURLLength, RequirePublicTLD: true}
+
+	if value := os.Getenv("URL_MAX_LENGTH"); value != "" {
+		length, err := strconv.Atoi(value)
+		if err != nil || length < 16 {
+			return policy, fmt.Errorf("invalid URL_MAX_LENGTH %q", value)
+		}
+		policy.MaxLength = length
+	}
+
+	flags := map[string]*bool{
+		"URL_ALLOW_PRIVATE":      &policy.AllowPrivate,
+		"URL_ALLOW_CREDENTIALS":  &policy.AllowCredentials,
+		"URL_REQUIRE_PUBLIC_TLD": &policy.RequirePublicTLD,
+	}
+	for name, field := range flags {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return policy, fmt.Errorf("invalid %s %q: must be true or false", name, value)
+		}
+		*field = parsed
+	}
+
+	return policy, nil
+}
+
+// validateURL checks a destination against the policy, returning the reason
+// it is rejected or an empty string if it is acceptable
+func validateURL(str string, policy validationPolicy) string {
+	if !isValidURL(str) {
+		return "URL must be a valid HTTP or HTTPS URL"
+	}
+
+	if len(str) > policy.MaxLength {
+		return fmt.Sprintf("URL must be at most %d characters long", policy.MaxLength)
+	}
+
+	u, _ := url.Parse(str)
+
+	if u.User != nil && !policy.AllowCredentials {
+		return "URL must not contain a username or password"
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return "URL must be a valid HTTP or HTTPS URL"
+	}
+
+	// IP literals are checked by address range rather than by name
+	if ip := net.ParseIP(host); ip != nil {
+		if !policy.AllowPrivate && isNonPublicIP(ip) {
+			return "URL must not point to a private, loopback or link-local address"
+		}
+		return ""
+	}
+
+	if !policy.RequirePublicTLD {
+		return ""
+	}
+
+	if host == "localhost" || !strings.Contains(host, ".") {
+		return "URL host must be a fully qualified domain name"
+	}
+
+	tld := host[strings.LastIndex(host, ".")+1:]
+	if nonPublicTLDs[tld] || !isPlausibleTLD(tld) {
+		return fmt.Sprintf("URL host must use a public top-level domain, not .%s", tld)
+	}
+
+	return ""
+}
+
+// isNonPublicIP reports whether ip is not routable on the public internet
+func isNonPublicIP(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast()
+}
+
+// isPlausibleTLD reports whether tld looks like a delegated top-level
+// domain: letters only, or an internationalized punycode label
+func isPlausibleTLD(tld string) bool {
+	if strings.HasPrefix(tld, "xn--") && len(tld) > 4 {
+		return true
+	}
+	if len(tld) < 2 {
+		return false
+	}
+	for _, char := range tld {
+		if !((char >= 'a' && char <= 'z') || char >= 0x80) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultWordCount = 2
+	minWordCount     = 1
+	maxWordCount     = 3 // more words rarely fit the 20 character custom code limit
+	wordCodeAttempts = 20
+)
+
+// wordCodeAdjectives and wordCodeNouns are short, easy to spell words so
+// that codes stay within the custom code length limit
+var wordCodeAdjectives = []string{
+	"able", "amber", "azure", "bold", "brave", "brisk", "calm", "clear",
+	"cool", "cozy", "crisp", "eager", "early", "fair", "fancy", "fast",
+	"fresh", "glad", "golden", "grand", "green", "happy", "jolly", "keen",
+	"kind", "lively", "lucky", "merry", "mild", "misty", "neat", "noble",
+	"polar", "proud", "quick", "quiet", "rapid", "ready", "royal", "rosy",
+	"sandy", "sharp", "shiny", "silver", "sleek", "smart", "snowy", "solar",
+	"sunny", "super", "swift", "tidy", "true", "vivid", "warm", "wise",
+	"witty", "young", "zesty", "zippy",
+}
+
+var wordCodeNouns = []string{
+	"badger", "bear", "bee", "bison", "cat", "crane", "deer", "dove",
+	"eagle", "elk", "falcon", "finch", "fox", "frog", "gecko", "goat",
+	"goose", "hare", "hawk", "heron", "horse", "koala", "lark", "lemur",
+	"lion", "llama", "lynx", "mole", "moose", "mouse", "newt", "otter",
+	"owl", "panda", "puma", "quail", "raven", "robin", "seal", "shark",
+	"sheep", "sloth", "snail", "swan", "tiger", "toad", "trout", "viper",
+	"whale", "wolf", "wren", "yak", "zebra",
+}
+
+// wordCount is the default number of words in a word-based code
+var wordCount = defaultWordCount
+
+// loadWordCount reads WORD_CODE_COUNT from the environment
+func loadWordCount() (int, error) {
+	value := os.Getenv("WORD_CODE_COUNT")
+	if value == "" {
+		return defaultWordCount, nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count < minWordCount || count > maxWordCount {
+		return 0, fmt.Errorf("invalid WORD_CODE_COUNT %q: must be between %d and %d", value, minWordCount, maxWordCount)
+	}
+	return count, nil
+}
+
+// generateWordCode generates a code such as "brave-otter-42" from count
+// words and a number, checked like a custom code. Combinations that come
+// out too long are simply redrawn.
+func generateWordCode(count int) (string, error) {
+	if count == 0 {
+		count = wordCount
+	}
+	if count < minWordCount || count > maxWordCount {
+		return "", fmt.Errorf("word_count must be between %d and %d", minWordCount, maxWordCount)
+	}
+
+	// Widen the number range if the two-digit space is crowded
+	for _, numbers := range [][2]int64{{2, 99}, {100, 9999}} {
+		for attempts := 0; attempts < wordCodeAttempts; attempts++ {
+			words := make([]string, 0, count+1)
+			for i := 0; i < count-1; i++ {
+				word, err := randomChoice(wordCodeAdjectives)
+				if err != nil {
+					return "", err
+				}
+				words = append(words, word)
+			}
+			noun, err := randomChoice(wordCodeNouns)
+			if err != nil {
+				return "", err
+			}
+			number, err := rand.Int(rand.Reader, big.NewInt(numbers[1]-numbers[0]+1))
+			if err != nil {
+				return "", err
+			}
+			words = append(words, noun, strconv.FormatInt(number.Int64()+numbers[0], 10))
+
+			code := strings.Join(words, "-")
+			if checkCustomCode(code) == nil {
+				return code, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("failed to generate unique word code")
+}
+
+// randomChoice returns a uniformly chosen element of words
+func randomChoice(words []string) (string, error) {
+	index, err := rand.Int(rand.Reader, big.NewInt(int64(len(words))))
+	if err != nil {
+		return "", err
+	}
+	return words[index.Int64()], nil
+}